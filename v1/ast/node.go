@@ -2,7 +2,12 @@ package ast
 
 import (
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
+	"strings"
+
+	"golang-yaml/v1/lexer"
 )
 
 type NodeKind int
@@ -15,12 +20,17 @@ const (
 	AliasNode
 )
 
+// Node is implemented by every node of a YAML tree. Anchor and SetAnchor
+// give the name of the anchor defined on the node, or "" for none; types
+// outside this package that implement Node must provide them too.
 type Node interface {
 	Kind() NodeKind
 	Tag() string
 	SetTag(tag string)
 	GetComment() Comment
 	SetComment(comment Comment)
+	Anchor() string
+	SetAnchor(anchor string)
 	Position() Position
 	SetPosition(pos Position)
 	Clone() Node
@@ -64,6 +74,14 @@ func (n *baseNode) SetComment(comment Comment) {
 	n.comment = comment
 }
 
+func (n *baseNode) Anchor() string {
+	return n.anchor
+}
+
+func (n *baseNode) SetAnchor(anchor string) {
+	n.anchor = anchor
+}
+
 func (n *baseNode) Position() Position {
 	return n.pos
 }
@@ -75,6 +93,10 @@ func (n *baseNode) SetPosition(pos Position) {
 type Document struct {
 	baseNode
 	Content []Node
+
+	// Version is the version named by a %YAML directive, or "" if the
+	// document has none.
+	Version string
 }
 
 func (n *Document) Kind() NodeKind {
@@ -82,16 +104,7 @@ func (n *Document) Kind() NodeKind {
 }
 
 func (n *Document) Clone() Node {
-	clone := &Document{
-		baseNode: n.baseNode,
-		Content:  make([]Node, len(n.Content)),
-	}
-	for i, node := range n.Content {
-		if node != nil {
-			clone.Content[i] = node.Clone()
-		}
-	}
-	return clone
+	return cloneTree(n, make(map[Node]Node))
 }
 
 func (n *Document) String() string {
@@ -102,6 +115,9 @@ type Scalar struct {
 	baseNode
 	Value string
 	Style ScalarStyle
+	// ExplicitTag reports whether the tag was written in the document, as
+	// in "!!str 2001-12-14", rather than resolved from the value.
+	ExplicitTag bool
 }
 
 type ScalarStyle int
@@ -120,17 +136,81 @@ func (n *Scalar) Kind() NodeKind {
 }
 
 func (n *Scalar) Clone() Node {
-	return &Scalar{
-		baseNode: n.baseNode,
-		Value:    n.Value,
-		Style:    n.Style,
-	}
+	return cloneTree(n, make(map[Node]Node))
 }
 
 func (n *Scalar) String() string {
 	return fmt.Sprintf("Scalar(%s)", n.Value)
 }
 
+// AsString returns the scalar's value as written, without resolving it.
+func (n *Scalar) AsString() string {
+	return n.Value
+}
+
+// AsInt parses the scalar as an integer such as 42, 1_000, 0o17 or 0xFF. It
+// fails if the scalar is tagged with a type other than !!int.
+func (n *Scalar) AsInt() (int64, error) {
+	if err := n.checkTag("!!int"); err != nil {
+		return 0, err
+	}
+	digits, base, ok := lexer.SplitInt(n.Value)
+	if !ok {
+		return 0, fmt.Errorf("invalid integer value: %s", n.Value)
+	}
+	return strconv.ParseInt(digits, base, 64)
+}
+
+// AsFloat parses the scalar as a float, including integers and the special
+// values .inf, -.inf and .nan. It fails if the scalar is tagged with a type
+// other than !!float or !!int.
+func (n *Scalar) AsFloat() (float64, error) {
+	if err := n.checkTag("!!float", "!!int"); err != nil {
+		return 0, err
+	}
+	switch n.Value {
+	case ".inf", "+.inf":
+		return math.Inf(1), nil
+	case "-.inf":
+		return math.Inf(-1), nil
+	case ".nan":
+		return math.NaN(), nil
+	}
+	if digits, base, ok := lexer.SplitInt(n.Value); ok {
+		i, err := strconv.ParseInt(digits, base, 64)
+		return float64(i), err
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(n.Value, "_", ""), 64)
+}
+
+// AsBool parses the scalar as a boolean. As in the decoder's default
+// settings, yes/no and on/off are accepted along with true/false. It fails
+// if the scalar is tagged with a type other than !!bool.
+func (n *Scalar) AsBool() (bool, error) {
+	if err := n.checkTag("!!bool"); err != nil {
+		return false, err
+	}
+	switch strings.ToLower(n.Value) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value: %s", n.Value)
+}
+
+func (n *Scalar) checkTag(allowed ...string) error {
+	if n.tag == "" {
+		return nil
+	}
+	for _, tag := range allowed {
+		if n.tag == tag {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot read %s scalar as %s", n.tag, allowed[0])
+}
+
 type Mapping struct {
 	baseNode
 	Content []*MappingEntry
@@ -155,32 +235,51 @@ func (n *Mapping) Kind() NodeKind {
 }
 
 func (n *Mapping) Clone() Node {
-	clone := &Mapping{
-		baseNode: n.baseNode,
-		Content:  make([]*MappingEntry, len(n.Content)),
-		Style:    n.Style,
-	}
-	for i, entry := range n.Content {
-		if entry != nil {
-			cloneEntry := &MappingEntry{
-				Comment: entry.Comment,
-			}
-			if entry.Key != nil {
-				cloneEntry.Key = entry.Key.Clone()
-			}
-			if entry.Value != nil {
-				cloneEntry.Value = entry.Value.Clone()
-			}
-			clone.Content[i] = cloneEntry
-		}
-	}
-	return clone
+	return cloneTree(n, make(map[Node]Node))
 }
 
 func (n *Mapping) String() string {
 	return fmt.Sprintf("Mapping(%d entries)", len(n.Content))
 }
 
+// Get returns the value of the first entry whose key is the scalar key.
+func (n *Mapping) Get(key string) (Node, bool) {
+	if i := n.index(key); i >= 0 {
+		return n.Content[i].Value, true
+	}
+	return nil, false
+}
+
+// Set replaces the value of the entry with the given key, keeping its
+// position, or appends a new entry if there is none.
+func (n *Mapping) Set(key string, value Node) {
+	if i := n.index(key); i >= 0 {
+		n.Content[i].Value = value
+		return
+	}
+	n.Content = append(n.Content, &MappingEntry{Key: NewScalar(key), Value: value})
+}
+
+// Delete removes the entry with the given key and reports whether there
+// was one.
+func (n *Mapping) Delete(key string) bool {
+	i := n.index(key)
+	if i < 0 {
+		return false
+	}
+	n.Content = append(n.Content[:i], n.Content[i+1:]...)
+	return true
+}
+
+func (n *Mapping) index(key string) int {
+	for i, entry := range n.Content {
+		if scalar, ok := entry.Key.(*Scalar); ok && scalar.Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
 type SortMode int
 
 const (
@@ -205,6 +304,18 @@ func (n *Mapping) Sort(mode SortMode, target SortTarget, compare func(a, b strin
 	}
 }
 
+// SortDeep sorts the mapping like Sort, and then every mapping nested in
+// it, including mappings inside sequences. The order of sequence items is
+// left unchanged, and aliases are not followed.
+func (n *Mapping) SortDeep(mode SortMode, target SortTarget, compare func(a, b string) int) {
+	Walk(n, func(_ string, node Node) bool {
+		if mapping, ok := node.(*Mapping); ok {
+			mapping.Sort(mode, target, compare)
+		}
+		return true
+	})
+}
+
 func (n *Mapping) sortByKeys(mode SortMode, compare func(a, b string) int) {
 	if compare == nil {
 		compare = defaultCompare
@@ -248,6 +359,58 @@ func defaultCompare(a, b string) int {
 	return 0
 }
 
+// NaturalCompare compares a and b like strings, except that runs of digits
+// are compared by their numeric value, so "item2" sorts before "item10".
+// It can be passed as the compare argument of Mapping.Sort and
+// Sequence.Sort.
+func NaturalCompare(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			startA, startB := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(a[startA:i], "0")
+			numB := strings.TrimLeft(b[startB:j], "0")
+			if len(numA) != len(numB) {
+				return sign(len(numA) - len(numB))
+			}
+			if result := defaultCompare(numA, numB); result != 0 {
+				return result
+			}
+			// Equal values: fewer leading zeros first
+			if result := sign((i - startA) - (j - startB)); result != 0 {
+				return result
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return defaultCompare(a[i:i+1], b[j:j+1])
+		}
+		i++
+		j++
+	}
+	return sign((len(a) - i) - (len(b) - j))
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
 func getNodeStringValue(node Node) string {
 	if node == nil {
 		return ""
@@ -272,26 +435,101 @@ func (n *Sequence) Kind() NodeKind {
 }
 
 func (n *Sequence) Clone() Node {
-	clone := &Sequence{
-		baseNode: n.baseNode,
-		Content:  make([]Node, len(n.Content)),
-		Style:    n.Style,
-	}
-	for i, node := range n.Content {
-		if node != nil {
-			clone.Content[i] = node.Clone()
-		}
-	}
-	return clone
+	return cloneTree(n, make(map[Node]Node))
 }
 
 func (n *Sequence) String() string {
 	return fmt.Sprintf("Sequence(%d items)", len(n.Content))
 }
 
+// Append adds nodes to the end of the sequence.
+func (n *Sequence) Append(nodes ...Node) {
+	n.Content = append(n.Content, nodes...)
+}
+
+// Insert places node at index, shifting later items back. index may equal
+// the length of the sequence to append.
+func (n *Sequence) Insert(index int, node Node) error {
+	if index < 0 || index > len(n.Content) {
+		return fmt.Errorf("index %d out of range for sequence of %d items", index, len(n.Content))
+	}
+	n.Content = append(n.Content, nil)
+	copy(n.Content[index+1:], n.Content[index:])
+	n.Content[index] = node
+	return nil
+}
+
+// RemoveAt removes the item at index and reports whether index was in
+// range.
+func (n *Sequence) RemoveAt(index int) bool {
+	if index < 0 || index >= len(n.Content) {
+		return false
+	}
+	n.Content = append(n.Content[:index], n.Content[index+1:]...)
+	return true
+}
+
+// Sort orders the items of the sequence. Scalar items are compared by
+// value; mapping items are compared by the value found at keyPath, a
+// dotted path of keys such as "name" or "meta.name", and sort as "" when
+// it is missing. A nil compare compares strings lexicographically.
+// SortOriginal leaves the items in place.
+func (n *Sequence) Sort(mode SortMode, keyPath string, compare func(a, b string) int) {
+	if mode == SortOriginal {
+		return
+	}
+	if compare == nil {
+		compare = defaultCompare
+	}
+
+	values := make(map[Node]string, len(n.Content))
+	for _, item := range n.Content {
+		values[item] = sortValue(item, keyPath)
+	}
+
+	sort.SliceStable(n.Content, func(i, j int) bool {
+		result := compare(values[n.Content[i]], values[n.Content[j]])
+		if mode == SortDescending {
+			return result > 0
+		}
+		return result < 0
+	})
+}
+
+func sortValue(item Node, keyPath string) string {
+	node := Resolve(item)
+	if keyPath == "" {
+		return getNodeStringValue(node)
+	}
+	for _, key := range strings.Split(keyPath, ".") {
+		mapping, ok := node.(*Mapping)
+		if !ok {
+			return ""
+		}
+		node = nil
+		for _, entry := range mapping.Content {
+			if getNodeStringValue(entry.Key) == key {
+				node = Resolve(entry.Value)
+				break
+			}
+		}
+		if node == nil {
+			return ""
+		}
+	}
+	if _, ok := node.(*Scalar); !ok {
+		return ""
+	}
+	return getNodeStringValue(node)
+}
+
 type Alias struct {
 	baseNode
 	Identifier string
+
+	// Value is the anchored node the alias refers to, if known. It is
+	// shared with the anchor's definition rather than owned by the alias.
+	Value Node
 }
 
 func (n *Alias) Kind() NodeKind {
@@ -299,16 +537,95 @@ func (n *Alias) Kind() NodeKind {
 }
 
 func (n *Alias) Clone() Node {
-	return &Alias{
-		baseNode:   n.baseNode,
-		Identifier: n.Identifier,
-	}
+	return cloneTree(n, make(map[Node]Node))
 }
 
 func (n *Alias) String() string {
 	return fmt.Sprintf("Alias(%s)", n.Identifier)
 }
 
+// cloneTree deep-copies node, keeping tags, anchors, positions and comments.
+// An alias whose anchored node lies inside the copied tree is pointed at the
+// copy of that node; other aliases keep sharing their original target.
+func cloneTree(node Node, clones map[Node]Node) Node {
+	switch n := node.(type) {
+	case *Document:
+		clone := &Document{
+			baseNode: n.baseNode,
+			Content:  make([]Node, len(n.Content)),
+			Version:  n.Version,
+		}
+		clones[n] = clone
+		for i, child := range n.Content {
+			if child != nil {
+				clone.Content[i] = cloneTree(child, clones)
+			}
+		}
+		return clone
+
+	case *Scalar:
+		clone := &Scalar{
+			baseNode:    n.baseNode,
+			Value:       n.Value,
+			Style:       n.Style,
+			ExplicitTag: n.ExplicitTag,
+		}
+		clones[n] = clone
+		return clone
+
+	case *Mapping:
+		clone := &Mapping{
+			baseNode: n.baseNode,
+			Content:  make([]*MappingEntry, len(n.Content)),
+			Style:    n.Style,
+		}
+		clones[n] = clone
+		for i, entry := range n.Content {
+			if entry == nil {
+				continue
+			}
+			cloneEntry := &MappingEntry{
+				Comment: entry.Comment,
+			}
+			if entry.Key != nil {
+				cloneEntry.Key = cloneTree(entry.Key, clones)
+			}
+			if entry.Value != nil {
+				cloneEntry.Value = cloneTree(entry.Value, clones)
+			}
+			clone.Content[i] = cloneEntry
+		}
+		return clone
+
+	case *Sequence:
+		clone := &Sequence{
+			baseNode: n.baseNode,
+			Content:  make([]Node, len(n.Content)),
+			Style:    n.Style,
+		}
+		clones[n] = clone
+		for i, child := range n.Content {
+			if child != nil {
+				clone.Content[i] = cloneTree(child, clones)
+			}
+		}
+		return clone
+
+	case *Alias:
+		clone := &Alias{
+			baseNode:   n.baseNode,
+			Identifier: n.Identifier,
+			Value:      n.Value,
+		}
+		if target, ok := clones[n.Value]; ok {
+			clone.Value = target
+		}
+		return clone
+	}
+
+	return node.Clone()
+}
+
 func NewDocument() *Document {
 	return &Document{
 		Content: make([]Node, 0),
@@ -341,3 +658,119 @@ func NewAlias(identifier string) *Alias {
 		Identifier: identifier,
 	}
 }
+
+// Equal reports whether a and b represent the same YAML content. Scalars
+// match on value and, when both are tagged, on tag; quoting style, comments,
+// anchors and positions are ignored. Mapping entries are compared regardless
+// of order, sequence items in order. Aliases compare as the node they refer
+// to.
+func Equal(a, b Node) bool {
+	a, b = Resolve(a), Resolve(b)
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Kind() != b.Kind() {
+		return false
+	}
+
+	switch x := a.(type) {
+	case *Document:
+		y := b.(*Document)
+		return equalNodes(x.Content, y.Content)
+
+	case *Scalar:
+		y := b.(*Scalar)
+		if x.Tag() != "" && y.Tag() != "" && x.Tag() != y.Tag() {
+			return false
+		}
+		return x.Value == y.Value
+
+	case *Sequence:
+		y := b.(*Sequence)
+		return equalNodes(x.Content, y.Content)
+
+	case *Mapping:
+		y := b.(*Mapping)
+		if len(x.Content) != len(y.Content) {
+			return false
+		}
+		used := make([]bool, len(y.Content))
+		for _, entry := range x.Content {
+			found := false
+			for i, other := range y.Content {
+				if !used[i] && Equal(entry.Key, other.Key) && Equal(entry.Value, other.Value) {
+					used[i] = true
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+
+	case *Alias:
+		return x.Identifier == b.(*Alias).Identifier
+	}
+
+	return false
+}
+
+func equalNodes(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve follows node through any aliases with a Value and returns the
+// node they refer to. Any other node, including an alias without a Value,
+// is returned unchanged.
+func Resolve(node Node) Node {
+	for {
+		alias, ok := node.(*Alias)
+		if !ok || alias.Value == nil {
+			return node
+		}
+		node = alias.Value
+	}
+}
+
+// Walk calls fn for node and every value beneath it in document order,
+// passing its dotted path, e.g. "servers[1].port". Mapping keys are not
+// visited themselves but name the path of their values, and aliases are not
+// followed. If fn returns false, the children of that node are skipped.
+func Walk(node Node, fn func(path string, node Node) bool) {
+	walk(node, "", fn)
+}
+
+func walk(node Node, path string, fn func(path string, node Node) bool) {
+	if node == nil || !fn(path, node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Document:
+		for _, content := range n.Content {
+			walk(content, path, fn)
+		}
+	case *Mapping:
+		for _, entry := range n.Content {
+			key := getNodeStringValue(entry.Key)
+			if path != "" {
+				key = path + "." + key
+			}
+			walk(entry.Value, key, fn)
+		}
+	case *Sequence:
+		for i, item := range n.Content {
+			walk(item, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
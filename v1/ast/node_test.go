@@ -0,0 +1,584 @@
+package ast
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	scalar := func(value, tag string, style ScalarStyle) *Scalar {
+		s := NewScalar(value)
+		s.SetTag(tag)
+		s.Style = style
+		return s
+	}
+	mapping := func(kv ...string) *Mapping {
+		m := NewMapping()
+		for i := 0; i < len(kv); i += 2 {
+			m.Content = append(m.Content, &MappingEntry{Key: NewScalar(kv[i]), Value: NewScalar(kv[i+1])})
+		}
+		return m
+	}
+	sequence := func(items ...string) *Sequence {
+		s := NewSequence()
+		for _, item := range items {
+			s.Content = append(s.Content, NewScalar(item))
+		}
+		return s
+	}
+
+	commented := NewScalar("a")
+	commented.SetComment(Comment{LineComment: "# note"})
+	commented.SetPosition(Position{Line: 3, Column: 5})
+
+	anchored := sequence("x", "y")
+	alias := NewAlias("xs")
+	alias.Value = anchored
+
+	tests := []struct {
+		name     string
+		a, b     Node
+		expected bool
+	}{
+		{"different quoting", scalar("a", "!!str", DoubleQuotedStyle), scalar("a", "!!str", PlainStyle), true},
+		{"different values", scalar("a", "!!str", PlainStyle), scalar("b", "!!str", PlainStyle), false},
+		{"different tags", scalar("42", "!!int", PlainStyle), scalar("42", "!!str", DoubleQuotedStyle), false},
+		{"untagged", NewScalar("42"), scalar("42", "!!int", PlainStyle), true},
+		{"comments and position", commented, NewScalar("a"), true},
+		{"mapping order", mapping("a", "1", "b", "2"), mapping("b", "2", "a", "1"), true},
+		{"mapping values", mapping("a", "1"), mapping("a", "2"), false},
+		{"mapping length", mapping("a", "1"), mapping("a", "1", "b", "2"), false},
+		{"sequence order", sequence("a", "b"), sequence("b", "a"), false},
+		{"sequence contents", sequence("a", "b"), sequence("a", "b"), true},
+		{"kind", NewScalar("a"), sequence("a"), false},
+		{"alias", alias, sequence("x", "y"), true},
+		{"nil", nil, nil, true},
+		{"nil and node", nil, NewScalar(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(tt.a, tt.b); got != tt.expected {
+				t.Errorf("Equal() = %v, want %v", got, tt.expected)
+			}
+			if got := Equal(tt.b, tt.a); got != tt.expected {
+				t.Errorf("Equal() reversed = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	target := NewScalar("value")
+	inner := NewAlias("inner")
+	inner.Value = target
+	outer := NewAlias("outer")
+	outer.Value = inner
+	dangling := NewAlias("missing")
+
+	tests := []struct {
+		name string
+		node Node
+		want Node
+	}{
+		{"plain node", target, target},
+		{"alias", inner, target},
+		{"alias to alias", outer, target},
+		{"alias without value", dangling, dangling},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.node); got != tt.want {
+			t.Errorf("%s: Resolve() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	decorate := func(n Node, name string, line int) Node {
+		n.SetTag("!" + name)
+		n.SetAnchor(name)
+		n.SetPosition(Position{Line: line, Column: 2, Offset: 10 * line})
+		n.SetComment(Comment{
+			HeadComment:  "# head " + name,
+			LineComment:  "# line " + name,
+			FootComment:  "# foot " + name,
+			KeyComment:   "# key " + name,
+			ValueComment: "# value " + name,
+		})
+		return n
+	}
+
+	doc := NewDocument()
+	doc.Version = "1.2"
+	mapping := NewMapping()
+	seq := NewSequence()
+	seq.Style = FlowStyle
+	scalar := NewScalar("v")
+	scalar.Style = SingleQuotedStyle
+	alias := NewAlias("seq")
+
+	seq.Content = []Node{scalar}
+	mapping.Content = []*MappingEntry{
+		{Key: NewScalar("items"), Value: seq, Comment: Comment{LineComment: "# entry"}},
+		{Key: NewScalar("again"), Value: alias},
+	}
+	doc.Content = []Node{mapping}
+	alias.Value = seq
+
+	nodes := []Node{
+		decorate(doc, "doc", 1),
+		decorate(mapping, "map", 2),
+		decorate(seq, "seq", 3),
+		decorate(scalar, "scalar", 4),
+		decorate(alias, "alias", 5),
+	}
+
+	for _, node := range nodes {
+		t.Run(node.String(), func(t *testing.T) {
+			clone := node.Clone()
+			if clone == node {
+				t.Fatal("Clone() returned the same node")
+			}
+			if clone.Kind() != node.Kind() {
+				t.Errorf("kind = %v, want %v", clone.Kind(), node.Kind())
+			}
+			if clone.Tag() != node.Tag() {
+				t.Errorf("tag = %q, want %q", clone.Tag(), node.Tag())
+			}
+			if clone.Anchor() != node.Anchor() {
+				t.Errorf("anchor = %q, want %q", clone.Anchor(), node.Anchor())
+			}
+			if clone.Position() != node.Position() {
+				t.Errorf("position = %+v, want %+v", clone.Position(), node.Position())
+			}
+			if clone.GetComment() != node.GetComment() {
+				t.Errorf("comment = %+v, want %+v", clone.GetComment(), node.GetComment())
+			}
+			if !Equal(clone, node) {
+				t.Error("clone is not equal to the original")
+			}
+		})
+	}
+
+	clone := doc.Clone().(*Document)
+	if clone.Version != "1.2" {
+		t.Errorf("version = %q, want 1.2", clone.Version)
+	}
+	clonedMapping := clone.Content[0].(*Mapping)
+	if clonedMapping.Content[0].Comment.LineComment != "# entry" {
+		t.Errorf("entry comment = %q, want %q", clonedMapping.Content[0].Comment.LineComment, "# entry")
+	}
+	clonedSeq := clonedMapping.Content[0].Value.(*Sequence)
+	if clonedSeq == seq || clonedSeq.Style != FlowStyle {
+		t.Errorf("sequence was not copied with its style")
+	}
+	if got := clonedSeq.Content[0].(*Scalar); got == scalar || got.Style != SingleQuotedStyle {
+		t.Errorf("scalar was not copied with its style")
+	}
+	if got := clonedMapping.Content[1].Value.(*Alias).Value; got != clonedSeq {
+		t.Error("alias in the clone should refer to the cloned anchor")
+	}
+	if got := alias.Clone().(*Alias).Value; got != seq {
+		t.Error("alias cloned on its own should keep its original target")
+	}
+}
+
+func TestScalarAccessors(t *testing.T) {
+	scalar := func(value, tag string) *Scalar {
+		s := NewScalar(value)
+		s.SetTag(tag)
+		return s
+	}
+
+	t.Run("AsInt", func(t *testing.T) {
+		tests := []struct {
+			scalar   *Scalar
+			expected int64
+			wantErr  bool
+		}{
+			{scalar("42", ""), 42, false},
+			{scalar("-1_000", ""), -1000, false},
+			{scalar("0xFF", ""), 255, false},
+			{scalar("0o17", ""), 15, false},
+			{scalar("0b101", "!!int"), 5, false},
+			{scalar("1.5", ""), 0, true},
+			{scalar("abc", ""), 0, true},
+			{scalar("42", "!!str"), 0, true},
+		}
+		for _, tt := range tests {
+			got, err := tt.scalar.AsInt()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AsInt(%q, %q) error = %v, wantErr %v", tt.scalar.Value, tt.scalar.Tag(), err, tt.wantErr)
+				continue
+			}
+			if got != tt.expected {
+				t.Errorf("AsInt(%q) = %d, want %d", tt.scalar.Value, got, tt.expected)
+			}
+		}
+	})
+
+	t.Run("AsFloat", func(t *testing.T) {
+		tests := []struct {
+			scalar   *Scalar
+			expected float64
+			wantErr  bool
+		}{
+			{scalar("1.5", ""), 1.5, false},
+			{scalar("1e3", ""), 1000, false},
+			{scalar(".inf", ""), math.Inf(1), false},
+			{scalar("-.inf", ""), math.Inf(-1), false},
+			{scalar("0xFF", ""), 255, false},
+			{scalar("7", "!!int"), 7, false},
+			{scalar("abc", ""), 0, true},
+			{scalar("1.5", "!!bool"), 0, true},
+		}
+		for _, tt := range tests {
+			got, err := tt.scalar.AsFloat()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AsFloat(%q, %q) error = %v, wantErr %v", tt.scalar.Value, tt.scalar.Tag(), err, tt.wantErr)
+				continue
+			}
+			if got != tt.expected {
+				t.Errorf("AsFloat(%q) = %v, want %v", tt.scalar.Value, got, tt.expected)
+			}
+		}
+
+		if got, err := scalar(".nan", "").AsFloat(); err != nil || !math.IsNaN(got) {
+			t.Errorf("AsFloat(.nan) = %v, %v, want NaN", got, err)
+		}
+	})
+
+	t.Run("AsBool", func(t *testing.T) {
+		tests := []struct {
+			scalar   *Scalar
+			expected bool
+			wantErr  bool
+		}{
+			{scalar("true", ""), true, false},
+			{scalar("False", ""), false, false},
+			{scalar("yes", ""), true, false},
+			{scalar("off", "!!bool"), false, false},
+			{scalar("maybe", ""), false, true},
+			{scalar("yes", "!!str"), false, true},
+		}
+		for _, tt := range tests {
+			got, err := tt.scalar.AsBool()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AsBool(%q, %q) error = %v, wantErr %v", tt.scalar.Value, tt.scalar.Tag(), err, tt.wantErr)
+				continue
+			}
+			if got != tt.expected {
+				t.Errorf("AsBool(%q) = %v, want %v", tt.scalar.Value, got, tt.expected)
+			}
+		}
+	})
+
+	t.Run("AsString", func(t *testing.T) {
+		for _, value := range []string{"0xFF", ".inf", "yes", "01234"} {
+			if got := scalar(value, "").AsString(); got != value {
+				t.Errorf("AsString() = %q, want %q", got, value)
+			}
+		}
+	})
+}
+
+func TestWalk(t *testing.T) {
+	inner := NewMapping()
+	inner.Content = append(inner.Content, &MappingEntry{Key: NewScalar("port"), Value: NewScalar("80")})
+	servers := NewSequence()
+	servers.Content = append(servers.Content, inner, NewScalar("backup"))
+	skipped := NewMapping()
+	skipped.Content = append(skipped.Content, &MappingEntry{Key: NewScalar("hidden"), Value: NewScalar("x")})
+	root := NewMapping()
+	root.Content = append(root.Content,
+		&MappingEntry{Key: NewScalar("servers"), Value: servers},
+		&MappingEntry{Key: NewScalar("skip"), Value: skipped},
+		&MappingEntry{Key: NewScalar("ref"), Value: NewAlias("a")},
+	)
+	doc := NewDocument()
+	doc.Content = append(doc.Content, root)
+
+	var visited []string
+	Walk(doc, func(path string, node Node) bool {
+		visited = append(visited, path+"="+node.String())
+		return path != "skip"
+	})
+
+	expected := []string{
+		"=Document(1 nodes)",
+		"=Mapping(3 entries)",
+		"servers=Sequence(2 items)",
+		"servers[0]=Mapping(1 entries)",
+		"servers[0].port=Scalar(80)",
+		"servers[1]=Scalar(backup)",
+		"skip=Mapping(1 entries)",
+		"ref=Alias(a)",
+	}
+	if len(visited) != len(expected) {
+		t.Fatalf("Walk() visited %v, want %v", visited, expected)
+	}
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Errorf("Walk() visit %d = %q, want %q", i, visited[i], expected[i])
+		}
+	}
+}
+
+func TestSequenceSort(t *testing.T) {
+	scalars := func(values ...string) *Sequence {
+		s := NewSequence()
+		for _, v := range values {
+			s.Content = append(s.Content, NewScalar(v))
+		}
+		return s
+	}
+	named := func(names ...string) *Sequence {
+		s := NewSequence()
+		for _, name := range names {
+			meta := NewMapping()
+			meta.Content = append(meta.Content, &MappingEntry{Key: NewScalar("name"), Value: NewScalar(name)})
+			item := NewMapping()
+			item.Content = append(item.Content,
+				&MappingEntry{Key: NewScalar("name"), Value: NewScalar(name)},
+				&MappingEntry{Key: NewScalar("meta"), Value: meta})
+			s.Content = append(s.Content, item)
+		}
+		return s
+	}
+	values := func(s *Sequence, keyPath string) []string {
+		var out []string
+		for _, item := range s.Content {
+			out = append(out, sortValue(item, keyPath))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		seq     *Sequence
+		mode    SortMode
+		keyPath string
+		want    []string
+	}{
+		{"scalars ascending", scalars("3", "1", "2"), SortAscending, "", []string{"1", "2", "3"}},
+		{"scalars descending", scalars("3", "1", "2"), SortDescending, "", []string{"3", "2", "1"}},
+		{"scalars original", scalars("3", "1", "2"), SortOriginal, "", []string{"3", "1", "2"}},
+		{"mappings by name", named("web", "api", "db"), SortAscending, "name", []string{"api", "db", "web"}},
+		{"mappings by nested key", named("web", "api", "db"), SortDescending, "meta.name", []string{"web", "db", "api"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.seq.Sort(tt.mode, tt.keyPath, nil)
+			got := values(tt.seq, tt.keyPath)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+
+	// Items missing the key sort first and keep their relative order
+	seq := named("b", "a")
+	seq.Content = append([]Node{NewScalar("x"), NewScalar("y")}, seq.Content...)
+	seq.Sort(SortAscending, "name", nil)
+	if first := seq.Content[0].(*Scalar).Value; first != "x" {
+		t.Errorf("expected x first, got %s", first)
+	}
+	if got := values(seq, "name"); got[2] != "a" || got[3] != "b" {
+		t.Errorf("expected a, b after the scalars, got %v", got)
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"item2", "item10", -1},
+		{"item10", "item2", 1},
+		{"item1", "item1", 0},
+		{"item", "item1", -1},
+		{"a2b", "a2c", -1},
+		{"v1.10", "v1.9", 1},
+		{"007", "7", 1},
+		{"abc", "abd", -1},
+		{"", "", 0},
+	}
+
+	for _, tt := range tests {
+		if got := NaturalCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	mapping := NewMapping()
+	for _, key := range []string{"item10", "item2", "item1"} {
+		mapping.Content = append(mapping.Content, &MappingEntry{Key: NewScalar(key), Value: NewScalar("")})
+	}
+	mapping.Sort(SortAscending, SortKeys, NaturalCompare)
+	var keys []string
+	for _, entry := range mapping.Content {
+		keys = append(keys, entry.Key.(*Scalar).Value)
+	}
+	if want := []string{"item1", "item2", "item10"}; strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("expected keys %v, got %v", want, keys)
+	}
+
+	seq := NewSequence()
+	for _, value := range []string{"item10", "item2", "item1"} {
+		seq.Content = append(seq.Content, NewScalar(value))
+	}
+	seq.Sort(SortDescending, "", NaturalCompare)
+	var items []string
+	for _, item := range seq.Content {
+		items = append(items, item.(*Scalar).Value)
+	}
+	if want := []string{"item10", "item2", "item1"}; strings.Join(items, ",") != strings.Join(want, ",") {
+		t.Errorf("expected items %v, got %v", want, items)
+	}
+}
+
+func TestMappingSortDeep(t *testing.T) {
+	mapping := func(kv ...interface{}) *Mapping {
+		m := NewMapping()
+		for i := 0; i < len(kv); i += 2 {
+			value, ok := kv[i+1].(Node)
+			if !ok {
+				value = NewScalar(kv[i+1].(string))
+			}
+			m.Content = append(m.Content, &MappingEntry{Key: NewScalar(kv[i].(string)), Value: value})
+		}
+		return m
+	}
+	keys := func(m *Mapping) string {
+		var out []string
+		for _, entry := range m.Content {
+			out = append(out, entry.Key.(*Scalar).Value)
+		}
+		return strings.Join(out, ",")
+	}
+
+	inner := mapping("z", "1", "a", "2", "m", "3")
+	item := mapping("y", "1", "b", "2")
+	list := NewSequence()
+	list.Content = append(list.Content, item)
+	root := mapping("server", inner, "list", list, "app", "x")
+
+	shallow := root.Clone().(*Mapping)
+	shallow.Sort(SortAscending, SortKeys, nil)
+	if got := keys(shallow); got != "app,list,server" {
+		t.Errorf("expected top-level keys sorted, got %s", got)
+	}
+	if got := keys(shallow.Content[2].Value.(*Mapping)); got != "z,a,m" {
+		t.Errorf("expected Sort to leave nested keys alone, got %s", got)
+	}
+
+	root.SortDeep(SortAscending, SortKeys, nil)
+	if got := keys(root); got != "app,list,server" {
+		t.Errorf("expected top-level keys sorted, got %s", got)
+	}
+	if got := keys(inner); got != "a,m,z" {
+		t.Errorf("expected nested keys sorted, got %s", got)
+	}
+	if got := keys(item); got != "b,y" {
+		t.Errorf("expected keys of sequence items sorted, got %s", got)
+	}
+}
+
+func TestMappingGetSetDelete(t *testing.T) {
+	m := NewMapping()
+	for _, kv := range [][2]string{{"name", "app"}, {"port", "80"}, {"debug", "false"}} {
+		m.Content = append(m.Content, &MappingEntry{Key: NewScalar(kv[0]), Value: NewScalar(kv[1])})
+	}
+	keys := func() string {
+		var out []string
+		for _, entry := range m.Content {
+			out = append(out, entry.Key.(*Scalar).Value)
+		}
+		return strings.Join(out, ",")
+	}
+
+	value, ok := m.Get("port")
+	if !ok || value.(*Scalar).Value != "80" {
+		t.Errorf("Get(port) = %v, %v", value, ok)
+	}
+	if _, ok := m.Get("missing"); ok {
+		t.Error("Get(missing) reported a value")
+	}
+
+	m.Set("port", NewScalar("8080"))
+	if value, _ := m.Get("port"); value.(*Scalar).Value != "8080" {
+		t.Errorf("expected port 8080 after Set, got %v", value)
+	}
+	if got := keys(); got != "name,port,debug" {
+		t.Errorf("expected Set to keep the key's position, got %s", got)
+	}
+
+	m.Set("host", NewScalar("localhost"))
+	if got := keys(); got != "name,port,debug,host" {
+		t.Errorf("expected Set to append a new key, got %s", got)
+	}
+
+	if !m.Delete("port") {
+		t.Error("Delete(port) = false")
+	}
+	if m.Delete("port") {
+		t.Error("Delete(port) twice = true")
+	}
+	if got := keys(); got != "name,debug,host" {
+		t.Errorf("expected port removed, got %s", got)
+	}
+}
+
+func TestSequenceEditing(t *testing.T) {
+	seq := NewSequence()
+	items := func() string {
+		var out []string
+		for _, item := range seq.Content {
+			out = append(out, item.(*Scalar).Value)
+		}
+		return strings.Join(out, ",")
+	}
+
+	seq.Append(NewScalar("b"), NewScalar("c"))
+	if got := items(); got != "b,c" {
+		t.Fatalf("expected b,c after Append, got %s", got)
+	}
+
+	if err := seq.Insert(0, NewScalar("a")); err != nil {
+		t.Fatalf("Insert at front: %v", err)
+	}
+	if err := seq.Insert(len(seq.Content), NewScalar("d")); err != nil {
+		t.Fatalf("Insert at end: %v", err)
+	}
+	if err := seq.Insert(2, NewScalar("x")); err != nil {
+		t.Fatalf("Insert in middle: %v", err)
+	}
+	if got := items(); got != "a,b,x,c,d" {
+		t.Fatalf("expected a,b,x,c,d after Insert, got %s", got)
+	}
+	for _, index := range []int{-1, 6} {
+		if err := seq.Insert(index, NewScalar("y")); err == nil {
+			t.Errorf("Insert(%d) expected error", index)
+		}
+	}
+
+	if !seq.RemoveAt(2) {
+		t.Error("RemoveAt(2) = false")
+	}
+	for _, index := range []int{-1, 4} {
+		if seq.RemoveAt(index) {
+			t.Errorf("RemoveAt(%d) = true", index)
+		}
+	}
+	if got := items(); got != "a,b,c,d" {
+		t.Errorf("expected a,b,c,d after RemoveAt, got %s", got)
+	}
+}
@@ -1,35 +1,233 @@
 package yaml
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"golang-yaml/v1/ast"
+	"golang-yaml/v1/lexer"
 	"golang-yaml/v1/parser"
 )
 
 type Decoder struct {
-	reader io.Reader
-	strict bool
+	reader              io.Reader
+	strict              bool
+	strictScalars       bool
+	leadingZeroAsString bool
+	strictArrays        bool
+	maxAliasExpansions  int
+	version             string
+	docVersion          string
+	aliases             map[*ast.Alias]ast.Node
+	aliasExpansions     int
+	boolStyle           BoolStyle
+	timestamps          bool
+	scalarHook          func(tag, value string) (string, bool)
 }
 
+// BoolStyle selects which plain scalars resolve to booleans.
+type BoolStyle int
+
+const (
+	// BoolDefault leaves the choice to the YAML version: yes/no/on/off are
+	// booleans under SetVersion("1.1") and strings otherwise. It is the zero
+	// value.
+	BoolDefault BoolStyle = iota
+	// BoolLegacy11 follows YAML 1.1, where yes/no/on/off are booleans as
+	// well as true/false.
+	BoolLegacy11
+	// BoolCore12 follows the YAML 1.2 core schema, where only true and
+	// false are booleans and yes/no/on/off are strings.
+	BoolCore12
+)
+
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{reader: r}
+	return &Decoder{reader: r, leadingZeroAsString: true, maxAliasExpansions: DefaultMaxAliasExpansions}
 }
 
+// SetStrict makes decoding fail on mapping keys that match no field of the
+// target struct. The check applies to every struct reached while decoding,
+// including nested structs and struct elements of slices and maps.
 func (d *Decoder) SetStrict(strict bool) {
 	d.strict = strict
 }
 
+// SetStrictArrays makes decoding a sequence into a Go array fail unless the
+// sequence has exactly as many items as the array. By default a shorter
+// sequence sets the remaining elements to their zero value, and only a
+// longer one is an error.
+func (d *Decoder) SetStrictArrays(strict bool) {
+	d.strictArrays = strict
+}
+
+// KnownFields is an alias for SetStrict.
+func (d *Decoder) KnownFields(enabled bool) {
+	d.SetStrict(enabled)
+}
+
+// SetStrictScalars stops quoted or !!str-tagged scalars from being coerced
+// into bool and numeric targets, so "true" only decodes into a string.
+func (d *Decoder) SetStrictScalars(strict bool) {
+	d.strictScalars = strict
+}
+
+// SetVersion selects the YAML version whose resolution rules apply to
+// documents without a %YAML directive. "1.2" follows the core schema, where
+// only true and false are booleans; "1.1" also accepts yes/no/on/off and
+// reads 0-prefixed integers as octal. The default, "", follows 1.2, so
+// yes/no/on/off are strings; 0-prefixed integers are also kept as strings
+// (see SetLeadingZeroAsString). Use SetVersion("1.1") or
+// SetBoolStyle(BoolLegacy11) to read yes/no/on/off as booleans. A %YAML
+// directive in the document always takes precedence, and SetBoolStyle
+// overrides the booleans.
+func (d *Decoder) SetVersion(version string) {
+	d.version = version
+}
+
+// SetBoolStyle selects whether yes/no/on/off decode as booleans. A %YAML
+// directive in the document takes precedence; otherwise any style other than
+// BoolDefault overrides the booleans implied by SetVersion.
+func (d *Decoder) SetBoolStyle(style BoolStyle) {
+	d.boolStyle = style
+}
+
+// SetDecodeTimestamps makes plain scalars that match the YAML timestamp
+// format, such as 2023-01-02 or 2023-01-02T15:04:05Z, decode into
+// interface{} values as time.Time instead of strings. Scalars tagged
+// !!timestamp always decode as time.Time.
+func (d *Decoder) SetDecodeTimestamps(enabled bool) {
+	d.timestamps = enabled
+}
+
+// SetScalarHook sets a function that may rewrite scalar values before
+// they are resolved, for example to expand ${VAR} placeholders. fn gets the
+// scalar's tag, such as "!!str" or "!!int", and its value; if it returns
+// true, the returned string is decoded in place of the value. The scalar
+// keeps its tag, so a !!str scalar rewritten to "8080" still decodes into
+// interface{} values as a string, while typed targets convert it as usual.
+func (d *Decoder) SetScalarHook(fn func(tag, value string) (string, bool)) {
+	d.scalarHook = fn
+}
+
+func (d *Decoder) hookScalar(scalar *ast.Scalar) *ast.Scalar {
+	if d.scalarHook == nil {
+		return scalar
+	}
+	value, ok := d.scalarHook(scalar.Tag(), scalar.Value)
+	if !ok {
+		return scalar
+	}
+	replaced := *scalar
+	replaced.Value = value
+	return &replaced
+}
+
+func (d *Decoder) activeVersion() string {
+	if d.docVersion != "" {
+		return d.docVersion
+	}
+	return d.version
+}
+
+// DefaultMaxAliasExpansions is the alias expansion limit of a new Decoder,
+// high enough for any realistic document but far below what a "billion
+// laughs" document expands to.
+const DefaultMaxAliasExpansions = 1000000
+
+// SetMaxAliasExpansions limits how many nodes aliases may copy, whether the
+// parser expands them or, for trees from UnmarshalNode passed to DecodeNode,
+// the decoder does. The limit defaults to DefaultMaxAliasExpansions; zero
+// removes it. See parser.Parser.SetMaxAliasExpansions.
+func (d *Decoder) SetMaxAliasExpansions(n int) {
+	d.maxAliasExpansions = n
+}
+
+// SetLeadingZeroAsString controls whether decimal integers written with a
+// leading zero, such as ZIP codes (01234), resolve to strings when decoding
+// into interface{} values. It is enabled by default; disabling it decodes
+// them as decimal integers. Typed integer targets always accept them as
+// numbers, and YAML 1.1 documents read them as octal.
+func (d *Decoder) SetLeadingZeroAsString(enabled bool) {
+	d.leadingZeroAsString = enabled
+}
+
+var (
+	tagFactoriesMu sync.RWMutex
+	tagFactories   = make(map[string]func() interface{})
+)
+
+// RegisterTag makes nodes tagged tag, such as "!Circle", decode into a new
+// value from factory whenever the target is an interface, which allows
+// polymorphic documents. factory should return a pointer, e.g.
+// func() interface{} { return &Circle{} }; the pointer is stored in the
+// target if it fits, otherwise the value it points to. A nil factory
+// removes the registration.
+func RegisterTag(tag string, factory func() interface{}) {
+	tagFactoriesMu.Lock()
+	defer tagFactoriesMu.Unlock()
+	if factory == nil {
+		delete(tagFactories, tag)
+		return
+	}
+	tagFactories[tag] = factory
+}
+
+func tagFactory(tag string) func() interface{} {
+	if tag == "" {
+		return nil
+	}
+	tagFactoriesMu.RLock()
+	defer tagFactoriesMu.RUnlock()
+	return tagFactories[tag]
+}
+
+// decodeRegistered decodes node into a new value from factory.
+func (d *Decoder) decodeRegistered(node ast.Node, factory func() interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(factory())
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() == reflect.Interface {
+		return reflect.Value{}, fmt.Errorf("factory for tag %s must return a non-nil pointer to a concrete type", node.Tag())
+	}
+	if err := d.decodeNode(node, value.Elem()); err != nil {
+		return reflect.Value{}, err
+	}
+	return value, nil
+}
+
+// Decode reads a YAML document and stores it in v. A key with no value, such
+// as "a:", decodes to nil in interface{} targets and sets typed targets to
+// their zero value; "a: {}" and "a: []" decode to empty collections.
 func (d *Decoder) Decode(v interface{}) error {
-	node, err := parser.ParseReader(d.reader)
+	p := parser.NewParser(d.reader)
+	p.SetMaxAliasExpansions(d.maxAliasExpansions)
+	node, err := p.Parse()
 	if err != nil {
 		return err
 	}
+	return d.DecodeNode(node, v)
+}
+
+// DecodeNode decodes an already parsed node tree into v, such as one returned
+// by UnmarshalNode. Aliases are resolved to their anchored nodes, however
+// deeply they are nested.
+func (d *Decoder) DecodeNode(node ast.Node, v interface{}) error {
+	d.docVersion = ""
+	if doc, ok := node.(*ast.Document); ok {
+		d.docVersion = doc.Version
+	}
+
+	d.aliases = make(map[*ast.Alias]ast.Node)
+	d.aliasExpansions = 0
+	bindAliases(node, make(map[string]ast.Node), d.aliases)
 
 	return d.decodeNode(node, reflect.ValueOf(v))
 }
@@ -40,6 +238,10 @@ func (d *Decoder) decodeNode(node ast.Node, v reflect.Value) error {
 	}
 
 	if v.Kind() == reflect.Ptr {
+		if v.CanSet() && isNullNode(node) {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
 		if v.IsNil() {
 			v.Set(reflect.New(v.Type().Elem()))
 		}
@@ -51,13 +253,59 @@ func (d *Decoder) decodeNode(node ast.Node, v reflect.Value) error {
 		return nil
 	}
 
+	switch v.Type() {
+	case rawNodeType:
+		v.Set(reflect.ValueOf(RawNode{Node: node}))
+		return nil
+	case jsonRawMessageType:
+		value, err := d.nodeToInterface(node)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("cannot convert node to JSON%s: %v", atPosition(node), err)
+		}
+		v.SetBytes(data)
+		return nil
+	}
+
 	if v.CanInterface() {
 		if unmarshaler, ok := v.Interface().(Unmarshaler); ok {
-			value := nodeToInterface(node)
+			value, err := d.nodeToInterface(node)
+			if err != nil {
+				return err
+			}
 			return unmarshaler.UnmarshalYAML(value)
 		}
 	}
 
+	if v.Kind() == reflect.Interface {
+		if factory := tagFactory(node.Tag()); factory != nil {
+			value, err := d.decodeRegistered(node, factory)
+			if err != nil {
+				return err
+			}
+			switch {
+			case value.Type().AssignableTo(v.Type()):
+				v.Set(value)
+			case value.Elem().Type().AssignableTo(v.Type()):
+				v.Set(value.Elem())
+			default:
+				return fmt.Errorf("cannot decode %s into %s: %s does not implement it%s",
+					node.Tag(), v.Type(), value.Type(), atPosition(node))
+			}
+			return nil
+		}
+	}
+
+	// An interface already holding a non-nil pointer is decoded through
+	// that pointer rather than replaced, except by null
+	if v.Kind() == reflect.Interface && !v.IsNil() && v.Elem().Kind() == reflect.Ptr &&
+		!v.Elem().IsNil() && !isNullNode(node) {
+		return d.decodeNode(node, v.Elem())
+	}
+
 	switch node.Kind() {
 	case ast.DocumentNode:
 		doc := node.(*ast.Document)
@@ -77,7 +325,11 @@ func (d *Decoder) decodeNode(node ast.Node, v reflect.Value) error {
 		return d.decodeSequence(node.(*ast.Sequence), v)
 
 	case ast.AliasNode:
-		return fmt.Errorf("alias nodes should be resolved before decoding")
+		target, err := d.expandAlias(node.(*ast.Alias))
+		if err != nil {
+			return err
+		}
+		return d.decodeNode(target, v)
 
 	default:
 		return fmt.Errorf("unknown node kind: %v", node.Kind())
@@ -85,10 +337,22 @@ func (d *Decoder) decodeNode(node ast.Node, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeScalar(scalar *ast.Scalar, v reflect.Value) error {
+	scalar = d.hookScalar(scalar)
+
+	if d.strictScalars && isExplicitString(scalar) {
+		switch v.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return fmt.Errorf("cannot decode string %q into %s", scalar.Value, v.Type())
+		}
+	}
+
 	switch v.Kind() {
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
-			value := parseScalarValue(scalar)
+			value := d.parseScalarValue(scalar)
 			if value == nil {
 				v.Set(reflect.Zero(v.Type()))
 			} else {
@@ -101,8 +365,25 @@ func (d *Decoder) decodeScalar(scalar *ast.Scalar, v reflect.Value) error {
 		v.SetString(scalar.Value)
 		return nil
 
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot decode scalar into %s", v.Type())
+		}
+		// Only !!binary scalars hold base64; any other scalar is stored
+		// as its text, so "data: hello" decodes to []byte("hello").
+		if scalar.Tag() != "!!binary" {
+			v.SetBytes([]byte(scalar.Value))
+			return nil
+		}
+		data, err := decodeBinary(scalar)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(data)
+		return nil
+
 	case reflect.Bool:
-		b, err := parseBool(scalar.Value)
+		b, err := d.parseBool(scalar.Value)
 		if err != nil {
 			return err
 		}
@@ -110,25 +391,43 @@ func (d *Decoder) decodeScalar(scalar *ast.Scalar, v reflect.Value) error {
 		return nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i, err := parseInt(scalar.Value, v.Type().Bits())
+		i, err := d.parseInt(scalar.Value, v.Type().Bits())
+		if err != nil && lexer.IsFloat(scalar.Value) {
+			var digits string
+			if digits, err = integralDigits(scalar, v); err == nil {
+				i, err = parseInt(digits, v.Type().Bits())
+			}
+		}
 		if err != nil {
-			return err
+			return scalarError(scalar, v, err)
 		}
 		v.SetInt(i)
 		return nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		u, err := parseUint(scalar.Value, v.Type().Bits())
+		u, err := d.parseUint(scalar.Value, v.Type().Bits())
+		if err != nil && lexer.IsFloat(scalar.Value) {
+			var digits string
+			if digits, err = integralDigits(scalar, v); err == nil {
+				u, err = parseUint(digits, v.Type().Bits())
+			}
+		}
 		if err != nil {
-			return err
+			return scalarError(scalar, v, err)
 		}
 		v.SetUint(u)
 		return nil
 
 	case reflect.Float32, reflect.Float64:
 		f, err := parseFloat(scalar.Value, v.Type().Bits())
+		if err != nil && lexer.IsInt(scalar.Value) {
+			var i int64
+			if i, err = d.parseInt(scalar.Value, 64); err == nil {
+				f = float64(i)
+			}
+		}
 		if err != nil {
-			return err
+			return scalarError(scalar, v, err)
 		}
 		v.SetFloat(f)
 		return nil
@@ -139,13 +438,29 @@ func (d *Decoder) decodeScalar(scalar *ast.Scalar, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeMapping(mapping *ast.Mapping, v reflect.Value) error {
+	if v.Type() == mapSliceType {
+		items, err := d.nodeToMapSlice(mapping)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	}
+
 	switch v.Kind() {
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
+			entries, err := d.mappingEntries(mapping)
+			if err != nil {
+				return err
+			}
 			mapValue := make(map[string]interface{})
-			for _, entry := range mapping.Content {
+			for _, entry := range entries {
 				key := getNodeStringValue(entry.Key)
-				value := nodeToInterface(entry.Value)
+				value, err := d.nodeToInterface(entry.Value)
+				if err != nil {
+					return wrapPath(key, err)
+				}
 				mapValue[key] = value
 			}
 			v.Set(reflect.ValueOf(mapValue))
@@ -156,18 +471,17 @@ func (d *Decoder) decodeMapping(mapping *ast.Mapping, v reflect.Value) error {
 		if v.IsNil() {
 			v.Set(reflect.MakeMap(v.Type()))
 		}
-		for _, entry := range mapping.Content {
-			keyValue := reflect.New(v.Type().Key()).Elem()
-			if err := d.decodeNode(entry.Key, keyValue); err != nil {
-				return err
-			}
-
-			elemValue := reflect.New(v.Type().Elem()).Elem()
-			if err := d.decodeNode(entry.Value, elemValue); err != nil {
+		if mapping.Tag() == "!!set" && isSetElem(v.Type().Elem()) {
+			return d.decodeSet(mapping, v)
+		}
+		entries, err := d.mappingEntries(mapping)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := d.decodeMapEntry(entry, v); err != nil {
 				return err
 			}
-
-			v.SetMapIndex(keyValue, elemValue)
 		}
 		return nil
 
@@ -179,35 +493,237 @@ func (d *Decoder) decodeMapping(mapping *ast.Mapping, v reflect.Value) error {
 	}
 }
 
-func (d *Decoder) decodeStruct(mapping *ast.Mapping, v reflect.Value) error {
-	t := v.Type()
-	fields := make(map[string]int)
+var (
+	mapSliceType       = reflect.TypeOf(MapSlice{})
+	rawNodeType        = reflect.TypeOf(RawNode{})
+	jsonRawMessageType = reflect.TypeOf(json.RawMessage{})
+)
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		if field.PkgPath != "" {
+func (d *Decoder) nodeToMapSlice(mapping *ast.Mapping) (MapSlice, error) {
+	entries, err := d.mappingEntries(mapping)
+	if err != nil {
+		return nil, err
+	}
+	items := make(MapSlice, 0, len(entries))
+	for _, entry := range entries {
+		key, err := d.nodeToInterface(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.nodeToOrdered(entry.Value)
+		if err != nil {
+			return nil, wrapPath(getNodeStringValue(entry.Key), err)
+		}
+		items = append(items, MapItem{Key: key, Value: value})
+	}
+	return items, nil
+}
+
+// nodeToOrdered is like nodeToInterface but keeps the key order of nested
+// mappings by decoding them as MapSlice.
+func (d *Decoder) nodeToOrdered(node ast.Node) (interface{}, error) {
+	if alias, ok := node.(*ast.Alias); ok {
+		target, err := d.expandAlias(alias)
+		if err != nil {
+			return nil, err
+		}
+		node = target
+	}
+
+	switch n := node.(type) {
+	case *ast.Mapping:
+		return d.nodeToMapSlice(n)
+	case *ast.Sequence:
+		if n.Tag() == "!!omap" {
+			if items, err := d.omapToMapSlice(n); err == nil {
+				return items, nil
+			}
+		}
+		s := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			value, err := d.nodeToOrdered(item)
+			if err != nil {
+				return nil, wrapPath(fmt.Sprintf("[%d]", i), err)
+			}
+			s[i] = value
+		}
+		return s, nil
+	default:
+		return d.nodeToInterface(node)
+	}
+}
+
+// isSetElem reports whether maps with elements of type t can hold a !!set:
+// map[K]struct{} or map[K]bool.
+func isSetElem(t reflect.Type) bool {
+	return t.Kind() == reflect.Bool || (t.Kind() == reflect.Struct && t.NumField() == 0)
+}
+
+// mappingEntries returns the entries of mapping with merge keys expanded.
+// A "<<" entry whose value is a mapping, or a sequence of mappings, is
+// replaced by their entries, except for keys the mapping already has or
+// an earlier mapping in the sequence provided.
+func (d *Decoder) mappingEntries(mapping *ast.Mapping) ([]*ast.MappingEntry, error) {
+	return d.expandMerges(mapping, make(map[*ast.Mapping]bool))
+}
+
+func (d *Decoder) expandMerges(mapping *ast.Mapping, visiting map[*ast.Mapping]bool) ([]*ast.MappingEntry, error) {
+	if visiting[mapping] {
+		return nil, fmt.Errorf("recursive merge key%s", atPosition(mapping))
+	}
+	visiting[mapping] = true
+	defer delete(visiting, mapping)
+
+	seen := make(map[string]bool)
+	hasMerge := false
+	for _, entry := range mapping.Content {
+		if isMergeKey(entry.Key) {
+			hasMerge = true
+			continue
+		}
+		seen[getNodeStringValue(entry.Key)] = true
+	}
+	if !hasMerge {
+		return mapping.Content, nil
+	}
+
+	entries := make([]*ast.MappingEntry, 0, len(mapping.Content))
+	for _, entry := range mapping.Content {
+		if !isMergeKey(entry.Key) {
+			entries = append(entries, entry)
 			continue
 		}
 
-		name := field.Name
-		tag := field.Tag.Get("yaml")
-		if tag != "" {
-			parts := strings.Split(tag, ",")
-			if parts[0] != "" {
-				name = parts[0]
+		sources, err := d.mergeSources(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			merged, err := d.expandMerges(source, visiting)
+			if err != nil {
+				return nil, err
 			}
-			if parts[0] == "-" {
-				continue
+			for _, m := range merged {
+				key := getNodeStringValue(m.Key)
+				if !seen[key] {
+					seen[key] = true
+					entries = append(entries, m)
+				}
 			}
 		}
+	}
+	return entries, nil
+}
+
+// mergeSources returns the mappings a merge key's value refers to.
+func (d *Decoder) mergeSources(node ast.Node) ([]*ast.Mapping, error) {
+	node, err := d.resolveNode(node)
+	if err != nil {
+		return nil, err
+	}
 
-		fields[strings.ToLower(name)] = i
-		if tag != "" && tag != "-" {
-			fields[strings.Split(tag, ",")[0]] = i
+	switch n := node.(type) {
+	case *ast.Mapping:
+		return []*ast.Mapping{n}, nil
+	case *ast.Sequence:
+		sources := make([]*ast.Mapping, 0, len(n.Content))
+		for _, item := range n.Content {
+			item, err := d.resolveNode(item)
+			if err != nil {
+				return nil, err
+			}
+			mapping, ok := item.(*ast.Mapping)
+			if !ok {
+				return nil, fmt.Errorf("merge key sequence must contain only mappings%s", atPosition(item))
+			}
+			sources = append(sources, mapping)
 		}
+		return sources, nil
+	default:
+		return nil, fmt.Errorf("merge key value must be a mapping or a sequence of mappings%s", atPosition(node))
+	}
+}
+
+func (d *Decoder) resolveNode(node ast.Node) (ast.Node, error) {
+	if alias, ok := node.(*ast.Alias); ok {
+		return d.expandAlias(alias)
+	}
+	return node, nil
+}
+
+func isMergeKey(node ast.Node) bool {
+	scalar, ok := node.(*ast.Scalar)
+	return ok && scalar.Value == "<<" && scalar.Style == ast.PlainStyle
+}
+
+// decodeSet adds each key of the !!set mapping to v as a member, with the
+// value true for map[K]bool.
+func (d *Decoder) decodeSet(mapping *ast.Mapping, v reflect.Value) error {
+	member := reflect.New(v.Type().Elem()).Elem()
+	if member.Kind() == reflect.Bool {
+		member.SetBool(true)
 	}
 
 	for _, entry := range mapping.Content {
+		if !isNullNode(entry.Value) {
+			return fmt.Errorf("!!set entry %s has a value%s", getNodeStringValue(entry.Key), atPosition(entry.Value))
+		}
+		keyValue := reflect.New(v.Type().Key()).Elem()
+		if err := d.decodeNode(entry.Key, keyValue); err != nil {
+			return err
+		}
+		v.SetMapIndex(keyValue, member)
+	}
+	return nil
+}
+
+// omapToMapSlice decodes an !!omap, a sequence of single-entry mappings, into
+// a MapSlice in sequence order.
+func (d *Decoder) omapToMapSlice(sequence *ast.Sequence) (MapSlice, error) {
+	items := make(MapSlice, 0, len(sequence.Content))
+	for i, item := range sequence.Content {
+		mapping, ok := item.(*ast.Mapping)
+		if !ok || len(mapping.Content) != 1 {
+			return nil, fmt.Errorf("!!omap item %d is not a single-entry mapping%s", i, atPosition(item))
+		}
+		entries, err := d.nodeToMapSlice(mapping)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entries...)
+	}
+	return items, nil
+}
+
+func (d *Decoder) decodeMapEntry(entry *ast.MappingEntry, v reflect.Value) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+
+	keyValue := reflect.New(v.Type().Key()).Elem()
+	if err := d.decodeNode(entry.Key, keyValue); err != nil {
+		return err
+	}
+
+	elemValue := reflect.New(v.Type().Elem()).Elem()
+	if err := d.decodeNode(entry.Value, elemValue); err != nil {
+		return wrapPath(getNodeStringValue(entry.Key), err)
+	}
+
+	v.SetMapIndex(keyValue, elemValue)
+	return nil
+}
+
+func (d *Decoder) decodeStruct(mapping *ast.Mapping, v reflect.Value) error {
+	fields := make(map[string][]int)
+	var inlineMap []int
+	collectFields(v.Type(), nil, fields, &inlineMap)
+
+	entries, err := d.mappingEntries(mapping)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
 		key := getNodeStringValue(entry.Key)
 
 		fieldIndex, ok := fields[strings.ToLower(key)]
@@ -216,28 +732,104 @@ func (d *Decoder) decodeStruct(mapping *ast.Mapping, v reflect.Value) error {
 		}
 
 		if !ok {
+			if inlineMap != nil {
+				if err := d.decodeMapEntry(entry, v.FieldByIndex(inlineMap)); err != nil {
+					return err
+				}
+				continue
+			}
 			if d.strict {
 				return fmt.Errorf("field %s not found in struct", key)
 			}
 			continue
 		}
 
-		field := v.Field(fieldIndex)
+		field := v.FieldByIndex(fieldIndex)
 		if err := d.decodeNode(entry.Value, field); err != nil {
-			return err
+			return wrapPath(key, err)
 		}
 	}
 
 	return nil
 }
 
+// collectFields maps the decodable keys of struct type t to field indexes.
+// Fields of structs tagged ,inline or embedded without a yaml name are
+// included as if declared on t, without shadowing t's own fields, and the
+// first map tagged ,inline is recorded in inlineMap to receive keys that
+// match no field.
+func collectFields(t reflect.Type, parent []int, fields map[string][]int, inlineMap *[]int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !isEmbeddedStruct(field) {
+			continue
+		}
+
+		name, options := parseFieldTag(field.Tag.Get("yaml"))
+		if name == "-" {
+			continue
+		}
+
+		index := append(append([]int(nil), parent...), i)
+		if name == "" && isEmbeddedStruct(field) {
+			collectFields(field.Type, index, fields, inlineMap)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if options["inline"] {
+			switch field.Type.Kind() {
+			case reflect.Struct:
+				collectFields(field.Type, index, fields, inlineMap)
+				continue
+			case reflect.Map:
+				if *inlineMap == nil {
+					*inlineMap = index
+				}
+				continue
+			}
+		}
+
+		keys := []string{strings.ToLower(field.Name)}
+		if name != "" {
+			keys = []string{strings.ToLower(name), name}
+		}
+		for _, key := range keys {
+			if _, exists := fields[key]; exists && len(parent) > 0 {
+				continue
+			}
+			fields[key] = index
+		}
+	}
+}
+
+// isEmbeddedStruct reports whether field is an anonymous struct field whose
+// fields are promoted into the enclosing struct.
+func isEmbeddedStruct(field reflect.StructField) bool {
+	return field.Anonymous && field.Type.Kind() == reflect.Struct
+}
+
 func (d *Decoder) decodeSequence(sequence *ast.Sequence, v reflect.Value) error {
+	if v.Type() == mapSliceType && sequence.Tag() == "!!omap" {
+		items, err := d.omapToMapSlice(sequence)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	}
+
 	switch v.Kind() {
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
 			slice := make([]interface{}, len(sequence.Content))
 			for i, item := range sequence.Content {
-				slice[i] = nodeToInterface(item)
+				value, err := d.nodeToInterface(item)
+				if err != nil {
+					return wrapPath(fmt.Sprintf("[%d]", i), err)
+				}
+				slice[i] = value
 			}
 			v.Set(reflect.ValueOf(slice))
 		}
@@ -247,21 +839,25 @@ func (d *Decoder) decodeSequence(sequence *ast.Sequence, v reflect.Value) error
 		slice := reflect.MakeSlice(v.Type(), len(sequence.Content), len(sequence.Content))
 		for i, item := range sequence.Content {
 			if err := d.decodeNode(item, slice.Index(i)); err != nil {
-				return err
+				return wrapPath(fmt.Sprintf("[%d]", i), err)
 			}
 		}
 		v.Set(slice)
 		return nil
 
 	case reflect.Array:
-		if v.Len() < len(sequence.Content) {
-			return fmt.Errorf("array too small for sequence")
+		n := len(sequence.Content)
+		if n > v.Len() || (d.strictArrays && n != v.Len()) {
+			return fmt.Errorf("cannot decode sequence of %d items into %s%s", n, v.Type(), atPosition(sequence))
 		}
 		for i, item := range sequence.Content {
 			if err := d.decodeNode(item, v.Index(i)); err != nil {
-				return err
+				return wrapPath(fmt.Sprintf("[%d]", i), err)
 			}
 		}
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
 		return nil
 
 	default:
@@ -269,6 +865,157 @@ func (d *Decoder) decodeSequence(sequence *ast.Sequence, v reflect.Value) error
 	}
 }
 
+// pathError records where in the document a decode error occurred, such as
+// "servers[1].port".
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	return fmt.Sprintf("%s: %v", e.path, e.err)
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+func wrapPath(segment string, err error) error {
+	if pe, ok := err.(*pathError); ok {
+		if strings.HasPrefix(pe.path, "[") {
+			return &pathError{path: segment + pe.path, err: pe.err}
+		}
+		return &pathError{path: segment + "." + pe.path, err: pe.err}
+	}
+	return &pathError{path: segment, err: err}
+}
+
+func scalarError(scalar *ast.Scalar, v reflect.Value, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("cannot decode %s into %s: value out of range", scalar.Value, v.Type())
+	}
+	return err
+}
+
+// atPosition describes where node appeared in the source, or returns an
+// empty string for nodes built without a position.
+func atPosition(node ast.Node) string {
+	pos := node.Position()
+	if pos.Line == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" at line %d, column %d", pos.Line, pos.Column)
+}
+
+func isExplicitString(scalar *ast.Scalar) bool {
+	switch scalar.Style {
+	case ast.SingleQuotedStyle, ast.DoubleQuotedStyle:
+		return true
+	}
+	return scalar.Tag() == "!!str"
+}
+
+func isNullNode(node ast.Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *ast.Document:
+		return len(n.Content) == 0 || isNullNode(n.Content[0])
+	case *ast.Scalar:
+		if n.Tag() == "!!null" {
+			return true
+		}
+		if n.Style != ast.PlainStyle || n.Tag() != "" {
+			return false
+		}
+		switch n.Value {
+		case "", "~", "null", "Null", "NULL":
+			return true
+		}
+	}
+	return false
+}
+
+// expandAlias returns the node alias refers to, falling back to the anchor
+// bound to it by bindAliases when the alias carries no value of its own,
+// and counts the nodes it copies against the limit set by
+// SetMaxAliasExpansions.
+func (d *Decoder) expandAlias(alias *ast.Alias) (ast.Node, error) {
+	target := alias.Value
+	if target == nil {
+		target = d.aliases[alias]
+	}
+	if target == nil {
+		return nil, fmt.Errorf("undefined alias: %s%s", alias.Identifier, atPosition(alias))
+	}
+	if d.maxAliasExpansions > 0 {
+		d.aliasExpansions += countNodes(target)
+		if d.aliasExpansions > d.maxAliasExpansions {
+			return nil, fmt.Errorf("alias expansion limit of %d nodes exceeded%s",
+				d.maxAliasExpansions, atPosition(alias))
+		}
+	}
+	return target, nil
+}
+
+// bindAliases records the target of every alias under node that carries no
+// value of its own: the last node anchored with its name before it in
+// document order. An anchor takes effect once its node ends, so an alias
+// cannot refer to a node containing it.
+func bindAliases(node ast.Node, anchors map[string]ast.Node, aliases map[*ast.Alias]ast.Node) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *ast.Alias:
+		if n.Value == nil {
+			if target, ok := anchors[n.Identifier]; ok {
+				aliases[n] = target
+			}
+		}
+		return
+	case *ast.Document:
+		for _, child := range n.Content {
+			bindAliases(child, anchors, aliases)
+		}
+	case *ast.Mapping:
+		for _, entry := range n.Content {
+			bindAliases(entry.Key, anchors, aliases)
+			bindAliases(entry.Value, anchors, aliases)
+		}
+	case *ast.Sequence:
+		for _, item := range n.Content {
+			bindAliases(item, anchors, aliases)
+		}
+	}
+
+	if name := node.Anchor(); name != "" {
+		anchors[name] = node
+	}
+}
+
+// countNodes returns the number of nodes in the tree under node, counting
+// an alias as a single node.
+func countNodes(node ast.Node) int {
+	switch n := node.(type) {
+	case nil:
+		return 0
+	case *ast.Mapping:
+		count := 1
+		for _, entry := range n.Content {
+			count += countNodes(entry.Key) + countNodes(entry.Value)
+		}
+		return count
+	case *ast.Sequence:
+		count := 1
+		for _, item := range n.Content {
+			count += countNodes(item)
+		}
+		return count
+	default:
+		return 1
+	}
+}
+
 func getNodeStringValue(node ast.Node) string {
 	if node == nil {
 		return ""
@@ -282,57 +1029,114 @@ func getNodeStringValue(node ast.Node) string {
 	}
 }
 
-func nodeToInterface(node ast.Node) interface{} {
+func nodeToInterface(node ast.Node) (interface{}, error) {
+	return NewDecoder(nil).nodeToInterface(node)
+}
+
+func (d *Decoder) nodeToInterface(node ast.Node) (interface{}, error) {
 	if node == nil {
-		return nil
+		return nil, nil
+	}
+
+	if factory := tagFactory(node.Tag()); factory != nil {
+		value, err := d.decodeRegistered(node, factory)
+		if err != nil {
+			return nil, err
+		}
+		return value.Interface(), nil
 	}
 
 	switch n := node.(type) {
 	case *ast.Scalar:
-		return parseScalarValue(n)
+		return d.parseScalarValue(d.hookScalar(n)), nil
 
 	case *ast.Mapping:
+		entries, err := d.mappingEntries(n)
+		if err != nil {
+			return nil, err
+		}
 		m := make(map[string]interface{})
-		for _, entry := range n.Content {
+		for _, entry := range entries {
 			key := getNodeStringValue(entry.Key)
-			m[key] = nodeToInterface(entry.Value)
+			value, err := d.nodeToInterface(entry.Value)
+			if err != nil {
+				return nil, wrapPath(key, err)
+			}
+			m[key] = value
 		}
-		return m
+		return m, nil
 
 	case *ast.Sequence:
 		s := make([]interface{}, len(n.Content))
 		for i, item := range n.Content {
-			s[i] = nodeToInterface(item)
+			value, err := d.nodeToInterface(item)
+			if err != nil {
+				return nil, wrapPath(fmt.Sprintf("[%d]", i), err)
+			}
+			s[i] = value
 		}
-		return s
+		return s, nil
 
 	case *ast.Document:
 		if len(n.Content) == 0 {
-			return nil
+			return nil, nil
+		}
+		return d.nodeToInterface(n.Content[0])
+
+	case *ast.Alias:
+		target, err := d.expandAlias(n)
+		if err != nil {
+			return nil, err
 		}
-		return nodeToInterface(n.Content[0])
+		return d.nodeToInterface(target)
 
 	default:
-		return nil
+		return nil, nil
 	}
 }
 
-func parseScalarValue(scalar *ast.Scalar) interface{} {
+func (d *Decoder) parseScalarValue(scalar *ast.Scalar) interface{} {
 	value := scalar.Value
 	tag := scalar.Tag()
 
+	if tag == "!!timestamp" {
+		if t, err := parseTimestamp(value); err == nil {
+			return t
+		}
+	}
+
+	if d.timestamps && scalar.Style == ast.PlainStyle && !scalar.ExplicitTag && (tag == "" || tag == "!!str") {
+		if t, err := parseTimestamp(value); err == nil {
+			return t
+		}
+	}
+
+	if tag == "!!str" || (tag == "" && (scalar.Style == ast.SingleQuotedStyle || scalar.Style == ast.DoubleQuotedStyle)) {
+		return value
+	}
+
 	if tag == "!!null" || value == "" || value == "null" || value == "~" {
 		return nil
 	}
 
+	if d.leadingZeroAsString && d.activeVersion() != "1.1" && (tag == "!!int" || tag == "") && hasLeadingZero(value) {
+		return value
+	}
+
+	if tag == "!!binary" {
+		if data, err := decodeBinary(scalar); err == nil {
+			return data
+		}
+	}
+
 	if tag == "!!bool" {
-		if b, err := parseBool(value); err == nil {
+		if b, err := d.parseBool(value); err == nil {
 			return b
 		}
 	}
 
 	if tag == "!!int" {
-		if i, err := parseInt(value, 64); err == nil {
+		if i, err := d.parseInt(value, 64); err == nil {
 			return i
 		}
 	}
@@ -343,15 +1147,11 @@ func parseScalarValue(scalar *ast.Scalar) interface{} {
 		}
 	}
 
-	if tag == "!!str" {
-		return value
-	}
-
-	if b, err := parseBool(value); err == nil {
+	if b, err := d.parseBool(value); err == nil {
 		return b
 	}
 
-	if i, err := parseInt(value, 64); err == nil {
+	if i, err := d.parseInt(value, 64); err == nil {
 		return i
 	}
 
@@ -362,6 +1162,109 @@ func parseScalarValue(scalar *ast.Scalar) interface{} {
 	return value
 }
 
+var timestampPattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$|` +
+	`^[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}(?:[Tt]|[ \t]+)[0-9]{1,2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]*)?` +
+	`(?:[ \t]*(?:Z|[-+][0-9]{1,2}(?::[0-9]{2})?))?$`)
+
+var timestampFormats = []string{
+	"2006-1-2T15:4:5.999999999Z07:00",
+	"2006-1-2T15:4:5.999999999Z07",
+	"2006-1-2T15:4:5.999999999",
+	"2006-1-2",
+}
+
+// parseTimestamp parses value if it matches the YAML timestamp format.
+// Timestamps without a time zone are UTC.
+func parseTimestamp(value string) (time.Time, error) {
+	if !timestampPattern.MatchString(value) {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+	}
+
+	// Normalize the separators the YAML grammar allows to the ones the
+	// layouts expect.
+	normalized := strings.Replace(value, "t", "T", 1)
+	if i := strings.IndexAny(normalized, " \t"); i > 0 && !strings.Contains(normalized, "T") {
+		normalized = normalized[:i] + "T" + strings.TrimLeft(normalized[i:], " \t")
+	}
+	if i := strings.LastIndexAny(normalized, " \t"); i > 0 {
+		normalized = normalized[:i] + strings.TrimLeft(normalized[i:], " \t")
+	}
+
+	for _, layout := range timestampFormats {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+}
+
+// decodeBinary decodes the base64 content of a !!binary scalar, ignoring the
+// line breaks and indentation of block scalars.
+func decodeBinary(scalar *ast.Scalar) ([]byte, error) {
+	value := strings.Join(strings.Fields(scalar.Value), "")
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid !!binary value%s: %v", atPosition(scalar), err)
+	}
+	return data, nil
+}
+
+func hasLeadingZero(value string) bool {
+	value = strings.TrimLeft(value, "+-")
+	if len(value) < 2 || value[0] != '0' {
+		return false
+	}
+	for _, ch := range value[1:] {
+		if (ch < '0' || ch > '9') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// coreBools reports whether only true and false resolve to booleans: under
+// a %YAML directive its version decides, then the bool style, then the
+// version set by SetVersion.
+func (d *Decoder) coreBools() bool {
+	if d.docVersion != "" {
+		return d.docVersion == "1.2"
+	}
+	switch d.boolStyle {
+	case BoolLegacy11:
+		return false
+	case BoolCore12:
+		return true
+	}
+	return d.version != "1.1"
+}
+
+func (d *Decoder) parseBool(value string) (bool, error) {
+	if d.coreBools() {
+		switch value {
+		case "true", "True", "TRUE":
+			return true, nil
+		case "false", "False", "FALSE":
+			return false, nil
+		}
+		return false, fmt.Errorf("invalid boolean value: %s", value)
+	}
+	return parseBool(value)
+}
+
+func (d *Decoder) parseInt(value string, bitSize int) (int64, error) {
+	if d.activeVersion() == "1.1" && hasLeadingZero(value) {
+		return strconv.ParseInt(strings.ReplaceAll(value, "_", ""), 8, bitSize)
+	}
+	return parseInt(value, bitSize)
+}
+
+func (d *Decoder) parseUint(value string, bitSize int) (uint64, error) {
+	if d.activeVersion() == "1.1" && hasLeadingZero(value) {
+		return strconv.ParseUint(strings.ReplaceAll(value, "_", ""), 8, bitSize)
+	}
+	return parseUint(value, bitSize)
+}
+
 func parseBool(value string) (bool, error) {
 	lower := strings.ToLower(value)
 	switch lower {
@@ -374,35 +1277,34 @@ func parseBool(value string) (bool, error) {
 }
 
 func parseInt(value string, bitSize int) (int64, error) {
-	value = strings.ReplaceAll(value, "_", "")
-
-	if strings.HasPrefix(value, "0x") {
-		return strconv.ParseInt(value[2:], 16, bitSize)
-	}
-	if strings.HasPrefix(value, "0o") {
-		return strconv.ParseInt(value[2:], 8, bitSize)
+	digits, base, ok := lexer.SplitInt(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid integer value: %s", value)
 	}
-	if strings.HasPrefix(value, "0b") {
-		return strconv.ParseInt(value[2:], 2, bitSize)
-	}
-
-	return strconv.ParseInt(value, 10, bitSize)
+	return strconv.ParseInt(digits, base, bitSize)
 }
 
 func parseUint(value string, bitSize int) (uint64, error) {
-	value = strings.ReplaceAll(value, "_", "")
-
-	if strings.HasPrefix(value, "0x") {
-		return strconv.ParseUint(value[2:], 16, bitSize)
+	digits, base, ok := lexer.SplitInt(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid integer value: %s", value)
 	}
-	if strings.HasPrefix(value, "0o") {
-		return strconv.ParseUint(value[2:], 8, bitSize)
+	return strconv.ParseUint(digits, base, bitSize)
+}
+
+// integralDigits lets integer targets accept float literals such as 3.0 or
+// 1e3 when they have no fractional part, returning the value's decimal
+// digits. Values like 3.5 are rejected rather than truncated. Float targets
+// accept any integer, so the coercion only ever loses precision, not value.
+func integralDigits(scalar *ast.Scalar, v reflect.Value) (string, error) {
+	f, err := parseFloat(scalar.Value, 64)
+	if err != nil {
+		return "", err
 	}
-	if strings.HasPrefix(value, "0b") {
-		return strconv.ParseUint(value[2:], 2, bitSize)
+	if math.IsInf(f, 0) || math.IsNaN(f) || f != math.Trunc(f) {
+		return "", fmt.Errorf("cannot decode %s into %s: not an integer%s", scalar.Value, v.Type(), atPosition(scalar))
 	}
-
-	return strconv.ParseUint(value, 10, bitSize)
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
 }
 
 func parseFloat(value string, bitSize int) (float64, error) {
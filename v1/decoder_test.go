@@ -1,10 +1,15 @@
 package yaml
 
 import (
+	"encoding/json"
 	"math"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"golang-yaml/v1/ast"
 )
 
 func TestDecoder_Scalars(t *testing.T) {
@@ -183,6 +188,65 @@ func TestDecoder_Slices(t *testing.T) {
 	}
 }
 
+func TestDecoder_SequenceIndentation(t *testing.T) {
+	type Service struct {
+		Name  string   `yaml:"name"`
+		Ports []int    `yaml:"ports"`
+		Tags  []string `yaml:"tags"`
+	}
+	type Config struct {
+		Services []Service `yaml:"services"`
+		Version  int       `yaml:"version"`
+	}
+
+	indented := `services:
+  - name: web
+    ports:
+      - 80
+      - 443
+    tags:
+      - public
+  - name: db
+    ports:
+      - 5432
+version: 2`
+
+	sameIndent := `services:
+- name: web
+  ports:
+  - 80
+  - 443
+  tags:
+  # exposed
+  - public
+- name: db
+  ports:
+  - 5432
+version: 2`
+
+	var want, got Config
+	if err := NewDecoder(strings.NewReader(indented)).Decode(&want); err != nil {
+		t.Fatalf("decode indented error: %v", err)
+	}
+	if err := NewDecoder(strings.NewReader(sameIndent)).Decode(&got); err != nil {
+		t.Fatalf("decode same-indent error: %v", err)
+	}
+
+	expected := Config{
+		Services: []Service{
+			{Name: "web", Ports: []int{80, 443}, Tags: []string{"public"}},
+			{Name: "db", Ports: []int{5432}},
+		},
+		Version: 2,
+	}
+	if !reflect.DeepEqual(want, expected) {
+		t.Errorf("indented: expected %+v, got %+v", expected, want)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("same indent: expected %+v, got %+v", expected, got)
+	}
+}
+
 func TestDecoder_Structs(t *testing.T) {
 	type SimpleStruct struct {
 		Name  string `yaml:"name"`
@@ -261,278 +325,1558 @@ default: value`,
 	}
 }
 
-func TestDecoder_SpecialValues(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected interface{}
-	}{
-		{"infinity", ".inf", math.Inf(1)},
-		{"negative infinity", "-.inf", math.Inf(-1)},
-		{"hex number", "0xDEADBEEF", int64(0xDEADBEEF)},
-		{"octal number", "0o777", int64(0777)},
-		{"binary number", "0b1010", int64(0b1010)},
-		{"scientific notation", "1.23e-4", 0.000123},
+func TestDecoder_PointerCollections(t *testing.T) {
+	type Config struct {
+		Tags   *[]string       `yaml:"tags"`
+		Limits *map[string]int `yaml:"limits"`
+		Extra  *[]string       `yaml:"extra"`
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			var result interface{}
-			dec := NewDecoder(strings.NewReader(tt.input))
-			err := dec.Decode(&result)
-			if err != nil {
-				t.Fatalf("decode error: %v", err)
-			}
-
-			// Handle NaN specially
-			if tt.name == "not a number" {
-				if f, ok := result.(float64); !ok || !math.IsNaN(f) {
-					t.Errorf("expected NaN, got %v", result)
-				}
-				return
-			}
+	input := `tags:
+  - a
+  - b
+limits:
+  cpu: 2
+  memory: 512
+extra: null`
 
-			// For floats, allow small differences
-			if expectedFloat, ok := tt.expected.(float64); ok {
-				if resultFloat, ok := result.(float64); ok {
-					if math.Abs(expectedFloat-resultFloat) > 0.0001 {
-						t.Errorf("expected %v, got %v", tt.expected, result)
-					}
-				} else {
-					t.Errorf("expected float64, got %T", result)
-				}
-			} else if !reflect.DeepEqual(result, tt.expected) {
-				t.Errorf("expected %v (%T), got %v (%T)", tt.expected, tt.expected, result, result)
-			}
-		})
+	var result Config
+	dec := NewDecoder(strings.NewReader(input))
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
 	}
-}
 
-func TestDecoder_FlowCollections(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected interface{}
-	}{
-		{
-			name:     "flow sequence",
-			input:    "[1, 2, 3]",
-			expected: []interface{}{int64(1), int64(2), int64(3)},
-		},
-		{
-			name:  "flow mapping",
-			input: "{a: 1, b: 2}",
-			expected: map[string]interface{}{
-				"a": int64(1),
-				"b": int64(2),
-			},
-		},
-		{
-			name:  "nested flow",
-			input: "[{a: 1}, {b: 2}]",
-			expected: []interface{}{
-				map[string]interface{}{"a": int64(1)},
-				map[string]interface{}{"b": int64(2)},
-			},
-		},
+	if result.Tags == nil {
+		t.Fatal("expected tags to be allocated")
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(*result.Tags, expected) {
+		t.Errorf("expected %v, got %v", expected, *result.Tags)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			var result interface{}
-			dec := NewDecoder(strings.NewReader(tt.input))
-			err := dec.Decode(&result)
-			if err != nil {
-				t.Fatalf("decode error: %v", err)
-			}
+	if result.Limits == nil {
+		t.Fatal("expected limits to be allocated")
+	}
+	if expected := map[string]int{"cpu": 2, "memory": 512}; !reflect.DeepEqual(*result.Limits, expected) {
+		t.Errorf("expected %v, got %v", expected, *result.Limits)
+	}
 
-			if !reflect.DeepEqual(result, tt.expected) {
-				t.Errorf("expected %v, got %v", tt.expected, result)
-			}
-		})
+	if result.Extra != nil {
+		t.Errorf("expected nil for null value, got %v", *result.Extra)
 	}
 }
 
-func TestDecoder_BlockScalars(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name: "literal block",
-			input: `text: |
-  line1
-  line2
-  line3`,
-			expected: "line1\nline2\nline3",
-		},
-		{
-			name: "folded block",
-			input: `text: >
-  line1
-  line2
+func TestDecoder_PointerTargets(t *testing.T) {
+	t.Run("double pointer", func(t *testing.T) {
+		var p **int
+		if err := NewDecoder(strings.NewReader("5")).Decode(&p); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if p == nil || *p == nil || **p != 5 {
+			t.Fatalf("expected **int pointing at 5, got %v", p)
+		}
 
-  line3`,
-			expected: "line1 line2\nline3",
-		},
-	}
+		if err := NewDecoder(strings.NewReader("null")).Decode(&p); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if p != nil {
+			t.Errorf("expected nil after decoding null, got %v", p)
+		}
+	})
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			var result map[string]string
-			dec := NewDecoder(strings.NewReader(tt.input))
-			err := dec.Decode(&result)
-			if err != nil {
-				t.Fatalf("decode error: %v", err)
-			}
+	t.Run("null into non-nil pointer field", func(t *testing.T) {
+		n := 3
+		pn := &n
+		result := struct {
+			P **int `yaml:"p"`
+		}{P: &pn}
+		if err := NewDecoder(strings.NewReader("p: null")).Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result.P != nil {
+			t.Errorf("expected nil pointer, got %v", result.P)
+		}
+		if n != 3 {
+			t.Errorf("expected pointee to be left alone, got %d", n)
+		}
+	})
 
-			if result["text"] != tt.expected {
-				t.Errorf("expected %q, got %q", tt.expected, result["text"])
-			}
-		})
-	}
+	t.Run("interface holding pointer", func(t *testing.T) {
+		n := 3
+		var target interface{} = &n
+		if err := NewDecoder(strings.NewReader("7")).Decode(&target); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if target != &n || n != 7 {
+			t.Errorf("expected decoding through the held pointer, got %v and n = %d", target, n)
+		}
+
+		if err := NewDecoder(strings.NewReader("null")).Decode(&target); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if target != nil {
+			t.Errorf("expected nil after decoding null, got %v", target)
+		}
+	})
+
+	t.Run("any", func(t *testing.T) {
+		var target any
+		if err := NewDecoder(strings.NewReader("[1, two]")).Decode(&target); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if expected := []interface{}{int64(1), "two"}; !reflect.DeepEqual(target, expected) {
+			t.Errorf("expected %v, got %v", expected, target)
+		}
+	})
 }
 
-func TestDecoder_Anchors(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected map[string]interface{}
-	}{
-		{
-			name: "simple anchor",
-			input: `default: &def value
-ref: *def`,
-			expected: map[string]interface{}{
-				"default": "value",
-				"ref":     "value",
-			},
-		},
-		{
-			name: "anchor on map",
-			input: `defaults: &defaults
-  timeout: 30
-  retries: 3
-service:
-  <<: *defaults
-  port: 8080`,
-			expected: map[string]interface{}{
-				"defaults": map[string]interface{}{
-					"timeout": int64(30),
-					"retries": int64(3),
-				},
-				"service": map[string]interface{}{
-					"timeout": int64(30),
-					"retries": int64(3),
-					"port":    int64(8080),
-				},
-			},
-		},
-	}
+type testShape interface {
+	Area() float64
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			var result map[string]interface{}
-			dec := NewDecoder(strings.NewReader(tt.input))
-			err := dec.Decode(&result)
-			if err != nil {
-				t.Fatalf("decode error: %v", err)
-			}
+type testCircle struct {
+	Radius float64 `yaml:"radius"`
+}
 
-			if !reflect.DeepEqual(result, tt.expected) {
-				t.Errorf("expected %v, got %v", tt.expected, result)
-			}
-		})
-	}
+func (c *testCircle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type testSquare struct {
+	Side float64 `yaml:"side"`
 }
 
-func TestDecoder_CustomUnmarshaler(t *testing.T) {
-	// This test assumes the Unmarshaler interface is properly implemented
-	// It's a placeholder for custom unmarshaling logic
+func (s testSquare) Area() float64 { return s.Side * s.Side }
 
-	type CustomType struct {
-		Value string
-	}
+func TestDecoder_RegisteredTags(t *testing.T) {
+	RegisterTag("!Circle", func() interface{} { return &testCircle{} })
+	RegisterTag("!Square", func() interface{} { return &testSquare{} })
+	defer RegisterTag("!Circle", nil)
+	defer RegisterTag("!Square", nil)
 
-	input := `value: custom`
+	input := `shapes:
+  - !Circle {radius: 2}
+  - !Square {side: 3}
+other: !Square {side: 1}
+plain: {side: 1}`
 
-	var result CustomType
-	dec := NewDecoder(strings.NewReader(input))
-	err := dec.Decode(&result)
+	var result struct {
+		Shapes []testShape            `yaml:"shapes"`
+		Other  interface{}            `yaml:"other"`
+		Plain  map[string]interface{} `yaml:"plain"`
+	}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
 
-	// The test will pass if decoding doesn't error
-	// Actual behavior depends on CustomType's UnmarshalYAML implementation
-	if err != nil && err.Error() != "unsupported type: chan" {
-		// Allow this specific error for now
+	expected := []testShape{&testCircle{Radius: 2}, &testSquare{Side: 3}}
+	if !reflect.DeepEqual(result.Shapes, expected) {
+		t.Errorf("expected %#v, got %#v", expected, result.Shapes)
+	}
+	if area := result.Shapes[0].Area() + result.Shapes[1].Area(); area != 21 {
+		t.Errorf("expected total area 21, got %v", area)
+	}
+	if !reflect.DeepEqual(result.Other, &testSquare{Side: 1}) {
+		t.Errorf("expected *testSquare in interface{} field, got %#v", result.Other)
+	}
+	if !reflect.DeepEqual(result.Plain, map[string]interface{}{"side": int64(1)}) {
+		t.Errorf("expected untagged mapping to decode as a map, got %#v", result.Plain)
 	}
-}
 
-func TestDecoder_StrictMode(t *testing.T) {
-	type Strict struct {
-		Known string `yaml:"known"`
+	var generic interface{}
+	if err := NewDecoder(strings.NewReader("[!Circle {radius: 1}]")).Decode(&generic); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if expected := []interface{}{&testCircle{Radius: 1}}; !reflect.DeepEqual(generic, expected) {
+		t.Errorf("expected %#v, got %#v", expected, generic)
 	}
 
-	input := `known: value
-unknown: ignored`
+	var wrong []testShape
+	RegisterTag("!Point", func() interface{} { return &struct{ X int }{} })
+	defer RegisterTag("!Point", nil)
+	if err := NewDecoder(strings.NewReader("- !Point {x: 1}")).Decode(&wrong); err == nil {
+		t.Error("expected error decoding a type that does not implement the target interface")
+	}
 
-	tests := []struct {
-		name      string
-		strict    bool
-		wantError bool
-	}{
-		{
-			name:      "strict mode enabled",
-			strict:    true,
-			wantError: true,
-		},
-		{
-			name:      "strict mode disabled",
-			strict:    false,
-			wantError: false,
-		},
+	// A tagged node that does not fit its registered type is an error, not
+	// a silent fallback to a plain map.
+	var untyped []interface{}
+	err := NewDecoder(strings.NewReader("- !Circle {radius: wide}")).Decode(&untyped)
+	if err == nil || !strings.HasPrefix(err.Error(), "[0].radius: ") {
+		t.Errorf("expected error decoding invalid !Circle, got %v", err)
 	}
+	var shapes map[string]interface{}
+	err = NewDecoder(strings.NewReader("shape: !Circle [1, 2]")).Decode(&shapes)
+	if err == nil || !strings.HasPrefix(err.Error(), "shape: ") {
+		t.Errorf("expected error decoding invalid !Circle, got %v", err)
+	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			var result Strict
-			dec := NewDecoder(strings.NewReader(input))
-			dec.SetStrict(tt.strict)
-			err := dec.Decode(&result)
+func TestDecoder_TopLevelPointerCollections(t *testing.T) {
+	var slice *[]int
+	if err := NewDecoder(strings.NewReader("- 1\n- 2")).Decode(&slice); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if slice == nil {
+		t.Fatal("expected slice pointer to be allocated")
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(*slice, expected) {
+		t.Errorf("expected %v, got %v", expected, *slice)
+	}
+
+	var m *map[string]int
+	if err := NewDecoder(strings.NewReader("a: 1\nb: 2")).Decode(&m); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if m == nil {
+		t.Fatal("expected map pointer to be allocated")
+	}
+	if expected := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(*m, expected) {
+		t.Errorf("expected %v, got %v", expected, *m)
+	}
+
+	var nested **[]string
+	if err := NewDecoder(strings.NewReader("[x, y]")).Decode(&nested); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if nested == nil || *nested == nil {
+		t.Fatal("expected nested pointers to be allocated")
+	}
+	if expected := []string{"x", "y"}; !reflect.DeepEqual(**nested, expected) {
+		t.Errorf("expected %v, got %v", expected, **nested)
+	}
+
+	existing := &[]int{9}
+	if err := NewDecoder(strings.NewReader("null")).Decode(&existing); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("expected null to reset pointer, got %v", *existing)
+	}
+}
+
+func TestDecoder_EmptyVersusNull(t *testing.T) {
+	input := `a: ""
+b:
+c: ''
+d: ~
+e: "null"`
+
+	var result map[string]interface{}
+	dec := NewDecoder(strings.NewReader(input))
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"a": "",
+		"b": nil,
+		"c": "",
+		"d": nil,
+		"e": "null",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %#v, got %#v", expected, result)
+	}
+
+	var typed struct {
+		A *string `yaml:"a"`
+		B *string `yaml:"b"`
+	}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&typed); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if typed.A == nil || *typed.A != "" {
+		t.Errorf("expected a to point to an empty string, got %v", typed.A)
+	}
+	if typed.B != nil {
+		t.Errorf("expected b to be nil, got %q", *typed.B)
+	}
+}
+
+func TestDecoder_EmptyMappingValues(t *testing.T) {
+	var generic map[string]interface{}
+	if err := NewDecoder(strings.NewReader("a:\nb: {}\nc: []")).Decode(&generic); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"a": nil,
+		"b": map[string]interface{}{},
+		"c": []interface{}{},
+	}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("expected %#v, got %#v", expected, generic)
+	}
+
+	type Typed struct {
+		A map[string]int `yaml:"a"`
+		B map[string]int `yaml:"b"`
+		S string         `yaml:"s"`
+		N int            `yaml:"n"`
+		P *int           `yaml:"p"`
+	}
+	one := 1
+	typed := Typed{A: map[string]int{"old": 1}, S: "old", N: 7, P: &one}
+	if err := NewDecoder(strings.NewReader("a:\nb: {}\ns:\nn:\np:")).Decode(&typed); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if typed.A != nil {
+		t.Errorf("expected a to be reset to nil, got %v", typed.A)
+	}
+	if typed.B == nil || len(typed.B) != 0 {
+		t.Errorf("expected b to be an empty map, got %#v", typed.B)
+	}
+	if typed.S != "" || typed.N != 0 || typed.P != nil {
+		t.Errorf("expected zero values, got %+v", typed)
+	}
+}
+
+func TestDecoder_Inline(t *testing.T) {
+	type Metadata struct {
+		Name string `yaml:"name"`
+		Kind string `yaml:"kind"`
+	}
+
+	type Resource struct {
+		Kind     string            `yaml:"kind"`
+		Metadata Metadata          `yaml:",inline"`
+		Extra    map[string]string `yaml:",inline"`
+	}
+
+	input := `kind: Service
+name: web
+owner: ops
+cost: low`
+
+	var result Resource
+	dec := NewDecoder(strings.NewReader(input))
+	dec.SetStrict(true)
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	expected := Resource{
+		Kind:     "Service",
+		Metadata: Metadata{Name: "web"},
+		Extra:    map[string]string{"owner": "ops", "cost": "low"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestDecoder_EmbeddedStructs(t *testing.T) {
+	type Base struct {
+		ID int
+	}
+	type User struct {
+		Base
+		Name string
+	}
+
+	var user User
+	dec := NewDecoder(strings.NewReader("id: 1\nname: x"))
+	dec.SetStrict(true)
+	if err := dec.Decode(&user); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if expected := (User{Base: Base{ID: 1}, Name: "x"}); !reflect.DeepEqual(user, expected) {
+		t.Errorf("expected %+v, got %+v", expected, user)
+	}
+
+	t.Run("outer field shadows promoted field", func(t *testing.T) {
+		type Shadow struct {
+			Base
+			ID string
+		}
+		var result Shadow
+		if err := NewDecoder(strings.NewReader("id: abc")).Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result.ID != "abc" || result.Base.ID != 0 {
+			t.Errorf("expected outer ID to be set, got %+v", result)
+		}
+	})
+
+	t.Run("named embedded field", func(t *testing.T) {
+		type Named struct {
+			Base `yaml:"base"`
+			Name string
+		}
+		var result Named
+		if err := NewDecoder(strings.NewReader("base:\n  id: 2\nname: y")).Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if expected := (Named{Base: Base{ID: 2}, Name: "y"}); !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %+v, got %+v", expected, result)
+		}
+	})
+
+	t.Run("unexported embedded type", func(t *testing.T) {
+		type base struct {
+			ID int
+		}
+		type Item struct {
+			base
+			Name string
+		}
+		var result Item
+		if err := NewDecoder(strings.NewReader("id: 3\nname: z")).Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result.ID != 3 || result.Name != "z" {
+			t.Errorf("expected ID 3 and name z, got %+v", result)
+		}
+	})
+}
+
+func TestDecoder_MapSlice(t *testing.T) {
+	input := `zebra: 1
+apple:
+  mango: x
+  banana: y
+list: [b, a]`
+
+	var result MapSlice
+	dec := NewDecoder(strings.NewReader(input))
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	expected := MapSlice{
+		{Key: "zebra", Value: int64(1)},
+		{Key: "apple", Value: MapSlice{
+			{Key: "mango", Value: "x"},
+			{Key: "banana", Value: "y"},
+		}},
+		{Key: "list", Value: []interface{}{"b", "a"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	var wrapped struct {
+		Config MapSlice `yaml:"config"`
+	}
+	if err := NewDecoder(strings.NewReader("config:\n  b: 2\n  a: 1")).Decode(&wrapped); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if expected := (MapSlice{{Key: "b", Value: int64(2)}, {Key: "a", Value: int64(1)}}); !reflect.DeepEqual(wrapped.Config, expected) {
+		t.Errorf("expected %v, got %v", expected, wrapped.Config)
+	}
+}
+
+func TestDecoder_StrictScalars(t *testing.T) {
+	type Flags struct {
+		Enabled bool `yaml:"enabled"`
+		Port    int  `yaml:"port"`
+	}
+
+	input := `enabled: "true"
+port: '8080'`
+
+	t.Run("coercion on", func(t *testing.T) {
+		var result Flags
+		dec := NewDecoder(strings.NewReader(input))
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if expected := (Flags{Enabled: true, Port: 8080}); result != expected {
+			t.Errorf("expected %+v, got %+v", expected, result)
+		}
+	})
+
+	t.Run("coercion off", func(t *testing.T) {
+		var result Flags
+		dec := NewDecoder(strings.NewReader(input))
+		dec.SetStrictScalars(true)
+		err := dec.Decode(&result)
+		if err == nil {
+			t.Fatal("expected error for quoted bool")
+		}
+		if expected := `enabled: cannot decode string "true" into bool`; err.Error() != expected {
+			t.Errorf("expected error %q, got %q", expected, err.Error())
+		}
+	})
+
+	t.Run("plain scalars unaffected", func(t *testing.T) {
+		var result Flags
+		dec := NewDecoder(strings.NewReader("enabled: true\nport: 8080"))
+		dec.SetStrictScalars(true)
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if expected := (Flags{Enabled: true, Port: 8080}); result != expected {
+			t.Errorf("expected %+v, got %+v", expected, result)
+		}
+	})
+}
+
+func TestDecoder_VersionDirective(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		version  string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "1.1 directive",
+			input:    "%YAML 1.1\n---\nx: yes\nmode: 0755",
+			expected: map[string]interface{}{"x": true, "mode": int64(493)},
+		},
+		{
+			name:     "default without directive or version",
+			input:    "x: yes\nmode: 0755\ncount: 0x1F",
+			expected: map[string]interface{}{"x": "yes", "mode": "0755", "count": int64(31)},
+		},
+		{
+			name:     "1.1 version without directive",
+			input:    "x: yes\nmode: 0755",
+			version:  "1.1",
+			expected: map[string]interface{}{"x": true, "mode": int64(493)},
+		},
+		{
+			name:     "1.2 version without directive",
+			input:    "x: yes\nmode: 0755",
+			version:  "1.2",
+			expected: map[string]interface{}{"x": "yes", "mode": "0755"},
+		},
+		{
+			name:     "1.1 directive overrides decoder version",
+			input:    "%YAML 1.1\n---\nx: yes",
+			version:  "1.2",
+			expected: map[string]interface{}{"x": true},
+		},
+		{
+			name:     "1.2 directive",
+			input:    "%YAML 1.2\n---\nx: on\ny: true",
+			expected: map[string]interface{}{"x": "on", "y": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.SetVersion(tt.version)
+			if err := dec.Decode(&result); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	var unsupported interface{}
+	if err := NewDecoder(strings.NewReader("%YAML 2.0\n---\nx: 1")).Decode(&unsupported); err == nil {
+		t.Error("expected error for unsupported YAML version")
+	}
+}
+
+func TestDecoder_BoolStyle(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		style    BoolStyle
+		version  string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "core default",
+			input:    "enabled: yes\ndebug: off\nready: true",
+			expected: map[string]interface{}{"enabled": "yes", "debug": "off", "ready": true},
+		},
+		{
+			name:     "legacy 1.1",
+			input:    "enabled: yes\ndebug: off\nready: true",
+			style:    BoolLegacy11,
+			expected: map[string]interface{}{"enabled": true, "debug": false, "ready": true},
+		},
+		{
+			name:     "core 1.2",
+			input:    "enabled: yes\ndebug: off\nready: true",
+			style:    BoolCore12,
+			expected: map[string]interface{}{"enabled": "yes", "debug": "off", "ready": true},
+		},
+		{
+			name:     "1.1 directive overrides core style",
+			input:    "%YAML 1.1\n---\nenabled: yes",
+			style:    BoolCore12,
+			expected: map[string]interface{}{"enabled": true},
+		},
+		{
+			name:     "1.2 directive overrides legacy style",
+			input:    "%YAML 1.2\n---\nenabled: yes",
+			style:    BoolLegacy11,
+			expected: map[string]interface{}{"enabled": "yes"},
+		},
+		{
+			name:     "default style follows version",
+			input:    "enabled: yes",
+			version:  "1.2",
+			expected: map[string]interface{}{"enabled": "yes"},
+		},
+		{
+			name:     "legacy style overrides version",
+			input:    "enabled: yes",
+			style:    BoolLegacy11,
+			version:  "1.2",
+			expected: map[string]interface{}{"enabled": true},
+		},
+		{
+			name:     "core style overrides version",
+			input:    "enabled: yes",
+			style:    BoolCore12,
+			version:  "1.1",
+			expected: map[string]interface{}{"enabled": "yes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.SetVersion(tt.version)
+			dec.SetBoolStyle(tt.style)
+			if err := dec.Decode(&result); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	type Flags struct {
+		Enabled bool   `yaml:"enabled"`
+		Answer  string `yaml:"answer"`
+	}
+
+	var flags Flags
+	dec := NewDecoder(strings.NewReader("enabled: yes\nanswer: no"))
+	dec.SetBoolStyle(BoolLegacy11)
+	if err := dec.Decode(&flags); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !flags.Enabled || flags.Answer != "no" {
+		t.Errorf("legacy: expected {true no}, got %+v", flags)
+	}
+
+	dec = NewDecoder(strings.NewReader("enabled: yes"))
+	if err := dec.Decode(&flags); err == nil {
+		t.Error("core 1.2: expected error decoding yes into bool")
+	}
+}
+
+func TestDecoder_LeadingZeroAsString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		enabled  bool
+		expected interface{}
+	}{
+		{"zip as string", "zip: 01234", true, "01234"},
+		{"zip as number", "zip: 01234", false, int64(1234)},
+		{"phone number", "zip: 0044123456", true, "0044123456"},
+		{"octal prefix unaffected", "zip: 0o17", true, int64(15)},
+		{"binary prefix unaffected", "zip: 0b101", true, int64(5)},
+		{"negative with leading zero", "zip: -0012", true, "-0012"},
+		{"plain zero unaffected", "zip: 0", true, int64(0)},
+		{"hex unaffected", "zip: 0x1F", true, int64(31)},
+		{"float unaffected", "zip: 0.5", true, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.SetLeadingZeroAsString(tt.enabled)
+			if err := dec.Decode(&result); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			if !reflect.DeepEqual(result["zip"], tt.expected) {
+				t.Errorf("expected %v (%T), got %v (%T)", tt.expected, tt.expected, result["zip"], result["zip"])
+			}
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		var result map[string]interface{}
+		if err := Unmarshal([]byte("zip: 01234"), &result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result["zip"] != "01234" {
+			t.Errorf("expected \"01234\", got %v (%T)", result["zip"], result["zip"])
+		}
+	})
+
+	t.Run("string target", func(t *testing.T) {
+		var result struct {
+			Zip string `yaml:"zip"`
+		}
+		if err := Unmarshal([]byte("zip: 01234"), &result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result.Zip != "01234" {
+			t.Errorf("expected \"01234\", got %q", result.Zip)
+		}
+	})
+
+	t.Run("typed integer target", func(t *testing.T) {
+		var result struct {
+			Zip int `yaml:"zip"`
+		}
+		dec := NewDecoder(strings.NewReader("zip: 01234"))
+		dec.SetLeadingZeroAsString(true)
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result.Zip != 1234 {
+			t.Errorf("expected 1234, got %d", result.Zip)
+		}
+	})
+}
+
+func TestDecoder_SpecialValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"infinity", ".inf", math.Inf(1)},
+		{"negative infinity", "-.inf", math.Inf(-1)},
+		{"hex number", "0xDEADBEEF", int64(0xDEADBEEF)},
+		{"octal number", "0o777", int64(0777)},
+		{"binary number", "0b1010", int64(0b1010)},
+		{"scientific notation", "1.23e-4", 0.000123},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			err := dec.Decode(&result)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			// Handle NaN specially
+			if tt.name == "not a number" {
+				if f, ok := result.(float64); !ok || !math.IsNaN(f) {
+					t.Errorf("expected NaN, got %v", result)
+				}
+				return
+			}
+
+			// For floats, allow small differences
+			if expectedFloat, ok := tt.expected.(float64); ok {
+				if resultFloat, ok := result.(float64); ok {
+					if math.Abs(expectedFloat-resultFloat) > 0.0001 {
+						t.Errorf("expected %v, got %v", tt.expected, result)
+					}
+				} else {
+					t.Errorf("expected float64, got %T", result)
+				}
+			} else if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v (%T), got %v (%T)", tt.expected, tt.expected, result, result)
+			}
+		})
+	}
+}
+
+func TestDecoder_Timestamps(t *testing.T) {
+	est := time.FixedZone("", -5*60*60)
+
+	tests := []struct {
+		name       string
+		input      string
+		timestamps bool
+		expected   interface{}
+	}{
+		{"date", "2002-12-14", true, time.Date(2002, 12, 14, 0, 0, 0, 0, time.UTC)},
+		{"canonical", "2001-12-15T02:59:43.1Z", true, time.Date(2001, 12, 15, 2, 59, 43, 100000000, time.UTC)},
+		{"iso8601", "2001-12-14t21:59:43.10-05:00", true, time.Date(2001, 12, 14, 21, 59, 43, 100000000, est)},
+		{"space separated", "2001-12-14 21:59:43.10 -05", true, time.Date(2001, 12, 14, 21, 59, 43, 100000000, est)},
+		{"no time zone", "2001-12-15 2:59:43.10", true, time.Date(2001, 12, 15, 2, 59, 43, 100000000, time.UTC)},
+		{"disabled", "2002-12-14", false, "2002-12-14"},
+		{"quoted", `"2002-12-14"`, true, "2002-12-14"},
+		{"not a date", "2002-12-14x", true, "2002-12-14x"},
+		{"explicit string", "!!str 2001-12-14", true, "2001-12-14"},
+		{"tagged", "!!timestamp 2002-12-14", false, time.Date(2002, 12, 14, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]interface{}
+			dec := NewDecoder(strings.NewReader("at: " + tt.input))
+			dec.SetDecodeTimestamps(tt.timestamps)
+			if err := dec.Decode(&result); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			if want, ok := tt.expected.(time.Time); ok {
+				got, ok := result["at"].(time.Time)
+				if !ok || !got.Equal(want) {
+					t.Errorf("expected %v, got %v (%T)", want, result["at"], result["at"])
+				}
+				return
+			}
+			if result["at"] != tt.expected {
+				t.Errorf("expected %v, got %v (%T)", tt.expected, result["at"], result["at"])
+			}
+		})
+	}
+}
+
+func TestDecoder_FlowCollections(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{
+			name:     "flow sequence",
+			input:    "[1, 2, 3]",
+			expected: []interface{}{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:  "flow mapping",
+			input: "{a: 1, b: 2}",
+			expected: map[string]interface{}{
+				"a": int64(1),
+				"b": int64(2),
+			},
+		},
+		{
+			name:  "nested flow",
+			input: "[{a: 1}, {b: 2}]",
+			expected: []interface{}{
+				map[string]interface{}{"a": int64(1)},
+				map[string]interface{}{"b": int64(2)},
+			},
+		},
+		{
+			name:  "empty flow mapping value",
+			input: "{a: , b: 2}",
+			expected: map[string]interface{}{
+				"a": nil,
+				"b": int64(2),
+			},
+		},
+		{
+			name:  "empty value before closing brace",
+			input: "{a: 1, b:}",
+			expected: map[string]interface{}{
+				"a": int64(1),
+				"b": nil,
+			},
+		},
+		{
+			name:  "key without colon",
+			input: "{a, b: 2}",
+			expected: map[string]interface{}{
+				"a": nil,
+				"b": int64(2),
+			},
+		},
+		{
+			name:  "nested empty value",
+			input: "x: {a: , b: 2}",
+			expected: map[string]interface{}{
+				"x": map[string]interface{}{"a": nil, "b": int64(2)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			err := dec.Decode(&result)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecoder_BlockScalars(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "literal block",
+			input: `text: |
+  line1
+  line2
+  line3`,
+			expected: "line1\nline2\nline3",
+		},
+		{
+			name: "folded block",
+			input: `text: >
+  line1
+  line2
+
+  line3`,
+			expected: "line1 line2\nline3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]string
+			dec := NewDecoder(strings.NewReader(tt.input))
+			err := dec.Decode(&result)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			if result["text"] != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result["text"])
+			}
+		})
+	}
+}
+
+func TestDecoder_Anchors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]interface{}
+	}{
+		{
+			name: "simple anchor",
+			input: `default: &def value
+ref: *def`,
+			expected: map[string]interface{}{
+				"default": "value",
+				"ref":     "value",
+			},
+		},
+		{
+			name: "anchor on map",
+			input: `defaults: &defaults
+  timeout: 30
+  retries: 3
+service:
+  <<: *defaults
+  port: 8080`,
+			expected: map[string]interface{}{
+				"defaults": map[string]interface{}{
+					"timeout": int64(30),
+					"retries": int64(3),
+				},
+				"service": map[string]interface{}{
+					"timeout": int64(30),
+					"retries": int64(3),
+					"port":    int64(8080),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			err := dec.Decode(&result)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecoder_CollectionAliases(t *testing.T) {
+	type Config struct {
+		List1 []string          `yaml:"list1"`
+		List2 []string          `yaml:"list2"`
+		Base  map[string]int    `yaml:"base"`
+		Copy  map[string]int    `yaml:"copy"`
+		Flow  []int             `yaml:"flow"`
+		Again []int             `yaml:"again"`
+		Items []map[string]bool `yaml:"items"`
+	}
+
+	input := `list1: &list1
+  - a
+  - b
+  - c
+list2: *list1
+base: &base
+  x: 1
+  y: 2
+copy: *base
+flow: &flow [1, 2]
+again: *flow
+items:
+  - &item
+    on: true
+  - *item`
+
+	var result Config
+	dec := NewDecoder(strings.NewReader(input))
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	expected := Config{
+		List1: []string{"a", "b", "c"},
+		List2: []string{"a", "b", "c"},
+		Base:  map[string]int{"x": 1, "y": 2},
+		Copy:  map[string]int{"x": 1, "y": 2},
+		Flow:  []int{1, 2},
+		Again: []int{1, 2},
+		Items: []map[string]bool{{"on": true}, {"on": true}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestDecoder_DecodeNodeAliases(t *testing.T) {
+	type Config struct {
+		Base   map[string]int   `yaml:"base"`
+		Copy   map[string]int   `yaml:"copy"`
+		Items  []string         `yaml:"items"`
+		Nested [][]string       `yaml:"nested"`
+		Deep   map[string][]int `yaml:"deep"`
+	}
+
+	input := `base: &base
+  x: 1
+name: &name widget
+items: [first, *name]
+nested:
+  - [*name, last]
+limits: &limits [1, 2]
+deep:
+  outer: *limits
+copy: *base`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	var result Config
+	if err := NewDecoder(nil).DecodeNode(node, &result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	expected := Config{
+		Base:   map[string]int{"x": 1},
+		Copy:   map[string]int{"x": 1},
+		Items:  []string{"first", "widget"},
+		Nested: [][]string{{"widget", "last"}},
+		Deep:   map[string][]int{"outer": {1, 2}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	// Aliases built without a Value are resolved through the anchor table.
+	anchored := ast.NewScalar("42")
+	anchored.SetAnchor("answer")
+	seq := ast.NewSequence()
+	seq.Content = []ast.Node{anchored, ast.NewAlias("answer")}
+
+	var numbers []int
+	if err := NewDecoder(nil).DecodeNode(seq, &numbers); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if expected := []int{42, 42}; !reflect.DeepEqual(numbers, expected) {
+		t.Errorf("expected %v, got %v", expected, numbers)
+	}
+
+	seq.Content = []ast.Node{ast.NewAlias("missing")}
+	err = NewDecoder(nil).DecodeNode(seq, &numbers)
+	if err == nil || err.Error() != "[0]: undefined alias: missing" {
+		t.Errorf("expected undefined alias error, got %v", err)
+	}
+}
+
+func TestDecoder_MaxAliasExpansions(t *testing.T) {
+	bomb := `a: &a [x, x, x, x]
+b: &b [*a, *a, *a, *a]
+c: [*b, *b, *b, *b]`
+
+	var result map[string]interface{}
+	dec := NewDecoder(strings.NewReader(bomb))
+	dec.SetMaxAliasExpansions(50)
+	if err := dec.Decode(&result); err == nil {
+		t.Error("expected alias expansion limit error")
+	}
+
+	dec = NewDecoder(strings.NewReader(bomb))
+	dec.SetMaxAliasExpansions(1000)
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if c, ok := result["c"].([]interface{}); !ok || len(c) != 4 {
+		t.Errorf("expected 4 items in c, got %v", result["c"])
+	}
+}
+
+func TestDecoder_DecodeNodeAliasLimits(t *testing.T) {
+	bomb := `a: &a [x, x, x, x]
+b: &b [*a, *a, *a, *a]
+c: [*b, *b, *b, *b]`
+
+	node, err := UnmarshalNode([]byte(bomb))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		target interface{}
+	}{
+		{"interface", new(interface{})},
+		{"typed", new(map[string][]interface{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(nil)
+			dec.SetMaxAliasExpansions(50)
+			err := dec.DecodeNode(node, tt.target)
+			if err == nil || !strings.Contains(err.Error(), "alias expansion limit of 50 nodes exceeded at line") {
+				t.Errorf("expected alias expansion limit error, got %v", err)
+			}
+		})
+	}
+
+	// Aliases bind to the last anchor with their name before them.
+	seq := ast.NewSequence()
+	first := ast.NewScalar("1")
+	first.SetAnchor("x")
+	second := ast.NewScalar("2")
+	second.SetAnchor("x")
+	seq.Content = []ast.Node{first, ast.NewAlias("x"), second, ast.NewAlias("x")}
+
+	var numbers []int
+	if err := NewDecoder(nil).DecodeNode(seq, &numbers); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if expected := []int{1, 1, 2, 2}; !reflect.DeepEqual(numbers, expected) {
+		t.Errorf("expected %v, got %v", expected, numbers)
+	}
+
+	// An alias inside the node carrying its anchor has no target yet.
+	self := ast.NewSequence()
+	self.SetAnchor("self")
+	self.Content = []ast.Node{ast.NewAlias("self")}
+	var anything interface{}
+	err = NewDecoder(nil).DecodeNode(self, &anything)
+	if err == nil || err.Error() != "[0]: undefined alias: self" {
+		t.Errorf("expected undefined alias error, got %v", err)
+	}
+
+	mapping := ast.NewMapping()
+	mapping.Content = []*ast.MappingEntry{
+		{Key: ast.NewScalar("ref"), Value: ast.NewAlias("missing")},
+	}
+	err = NewDecoder(nil).DecodeNode(mapping, &anything)
+	if err == nil || err.Error() != "ref: undefined alias: missing" {
+		t.Errorf("expected undefined alias error, got %v", err)
+	}
+}
+
+func TestDecoder_CustomUnmarshaler(t *testing.T) {
+	// This test assumes the Unmarshaler interface is properly implemented
+	// It's a placeholder for custom unmarshaling logic
+
+	type CustomType struct {
+		Value string
+	}
+
+	input := `value: custom`
+
+	var result CustomType
+	dec := NewDecoder(strings.NewReader(input))
+	err := dec.Decode(&result)
+
+	// The test will pass if decoding doesn't error
+	// Actual behavior depends on CustomType's UnmarshalYAML implementation
+	if err != nil && err.Error() != "unsupported type: chan" {
+		// Allow this specific error for now
+	}
+}
+
+func TestDecoder_StrictMode(t *testing.T) {
+	type Strict struct {
+		Known string `yaml:"known"`
+	}
+
+	input := `known: value
+unknown: ignored`
+
+	tests := []struct {
+		name      string
+		strict    bool
+		wantError bool
+	}{
+		{
+			name:      "strict mode enabled",
+			strict:    true,
+			wantError: true,
+		},
+		{
+			name:      "strict mode disabled",
+			strict:    false,
+			wantError: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result Strict
+			dec := NewDecoder(strings.NewReader(input))
+			dec.SetStrict(tt.strict)
+			err := dec.Decode(&result)
+
+			if tt.wantError && err == nil {
+				t.Error("expected error in strict mode")
+			} else if !tt.wantError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecoder_KnownFieldsNested(t *testing.T) {
+	type Port struct {
+		Number int `yaml:"number"`
+	}
+	type Server struct {
+		Host  string `yaml:"host"`
+		Ports []Port `yaml:"ports"`
+	}
+	type Config struct {
+		Server  Server           `yaml:"server"`
+		Backups map[string]*Port `yaml:"backups"`
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "nested struct",
+			input:   "server:\n  host: localhost\n  hots: typo\n",
+			wantErr: "server: field hots not found in struct",
+		},
+		{
+			name:    "struct in slice",
+			input:   "server:\n  ports:\n    - number: 80\n    - numbr: 443\n",
+			wantErr: "server.ports[1]: field numbr not found in struct",
+		},
+		{
+			name:    "struct in map",
+			input:   "backups:\n  primary:\n    num: 1\n",
+			wantErr: "backups.primary: field num not found in struct",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result Config
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.KnownFields(true)
+			err := dec.Decode(&result)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+
+			if err := NewDecoder(strings.NewReader(tt.input)).Decode(&result); err != nil {
+				t.Errorf("unexpected error without KnownFields: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecoder_KnownFieldsSliceElements(t *testing.T) {
+	type Item struct {
+		Name string `yaml:"name"`
+	}
+
+	input := "[{name: a}, {name: b, extra: 1}]"
+
+	var items []Item
+	err := UnmarshalStrict([]byte(input), &items)
+	if want := "[1]: field extra not found in struct"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+
+	var arrays [2]Item
+	dec := NewDecoder(strings.NewReader(input))
+	dec.SetStrict(true)
+	if err := dec.Decode(&arrays); err == nil || !strings.Contains(err.Error(), "[1]: field extra") {
+		t.Errorf("expected error for element 1 of array, got %v", err)
+	}
+
+	items = nil
+	if err := Unmarshal([]byte(input), &items); err != nil {
+		t.Fatalf("unexpected error without strict mode: %v", err)
+	}
+	if want := []Item{{Name: "a"}, {Name: "b"}}; !reflect.DeepEqual(items, want) {
+		t.Errorf("expected %v, got %v", want, items)
+	}
+}
+
+func TestDecoder_ErrorCases(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		target    interface{}
+		wantError bool
+	}{
+		{
+			name:      "invalid yaml",
+			input:     "key: : value",
+			target:    new(map[string]interface{}),
+			wantError: false, // May not error depending on parser
+		},
+		{
+			name:      "type mismatch",
+			input:     "notanumber",
+			target:    new(int),
+			wantError: true,
+		},
+		{
+			name:      "undefined alias",
+			input:     "value: *undefined",
+			target:    new(map[string]interface{}),
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.input))
+			err := dec.Decode(tt.target)
+
+			if tt.wantError && err == nil {
+				t.Error("expected error but got none")
+			} else if !tt.wantError && err != nil {
+				// Some errors are acceptable
+				if err.Error() != "cannot unmarshal" && !strings.Contains(err.Error(), "cannot decode") {
+					// Ignore expected conversion errors
+				}
+			}
+		})
+	}
+}
+
+func TestDecoder_IntegerGrammar(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1_000_000", int64(1000000)},
+		{"+42", int64(42)},
+		{"0x_FF", int64(255)},
+		{"0xFE", int64(254)},
+		{"0o_17", int64(15)},
+		{"-0b101", int64(-5)},
+		{"1__0", "1__0"},
+		{"_5", "_5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var result interface{}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			if err := dec.Decode(&result); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v (%T), got %v (%T)", tt.expected, tt.expected, result, result)
+			}
 
-			if tt.wantError && err == nil {
-				t.Error("expected error in strict mode")
-			} else if !tt.wantError && err != nil {
-				t.Errorf("unexpected error: %v", err)
+			var typed int
+			err := NewDecoder(strings.NewReader(tt.input)).Decode(&typed)
+			if _, isString := tt.expected.(string); isString != (err != nil) {
+				t.Errorf("decode into int: unexpected error state %v", err)
 			}
 		})
 	}
 }
 
-func TestDecoder_ErrorCases(t *testing.T) {
+func TestDecoder_VersionStrings(t *testing.T) {
+	input := `version: 1.2.3
+release: 2.0.0
+address: 10.0.0.1
+ratio: 1.5`
+
+	var generic map[string]interface{}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&generic); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"version": "1.2.3",
+		"release": "2.0.0",
+		"address": "10.0.0.1",
+		"ratio":   1.5,
+	}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("expected %#v, got %#v", expected, generic)
+	}
+
+	var typed struct {
+		Version string `yaml:"version"`
+	}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&typed); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if typed.Version != "1.2.3" {
+		t.Errorf("expected version 1.2.3, got %q", typed.Version)
+	}
+
+	var number struct {
+		Version float64 `yaml:"version"`
+	}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&number); err == nil {
+		t.Errorf("expected error decoding 1.2.3 into float64, got %v", number.Version)
+	}
+}
+
+func TestDecoder_ScientificIntegers(t *testing.T) {
+	type Limits struct {
+		Max   int    `yaml:"max"`
+		Bytes uint64 `yaml:"bytes"`
+	}
+
+	var result Limits
+	dec := NewDecoder(strings.NewReader("max: 1e3\nbytes: 2.5e1"))
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if expected := (Limits{Max: 1000, Bytes: 25}); result != expected {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	errorCases := []struct {
+		input   string
+		target  interface{}
+		wantErr string
+	}{
+		{"1.5e0", new(int), "cannot decode 1.5e0 into int: not an integer at line 1, column 1"},
+		{"2.5", new(uint), "cannot decode 2.5 into uint: not an integer at line 1, column 1"},
+		{"1e20", new(int64), "cannot decode 1e20 into int64: value out of range"},
+	}
+
+	for _, tt := range errorCases {
+		t.Run(tt.input, func(t *testing.T) {
+			err := NewDecoder(strings.NewReader(tt.input)).Decode(tt.target)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDecoder_NumericCoercion(t *testing.T) {
+	type Int struct {
+		X int `yaml:"x"`
+	}
+	type Float struct {
+		X float64 `yaml:"x"`
+	}
+
 	tests := []struct {
-		name      string
-		input     string
-		target    interface{}
-		wantError bool
+		name     string
+		input    string
+		target   interface{}
+		expected interface{}
+		wantErr  string
+	}{
+		{name: "integral float into int", input: "x: 3.0", target: &Int{}, expected: &Int{X: 3}},
+		{name: "fractional float into int", input: "n: 1\nx: 3.5", target: &Int{},
+			wantErr: "x: cannot decode 3.5 into int: not an integer at line 2, column 4"},
+		{name: "int into float", input: "x: 5", target: &Float{}, expected: &Float{X: 5.0}},
+		{name: "hex int into float", input: "x: 0x10", target: &Float{}, expected: &Float{X: 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewDecoder(strings.NewReader(tt.input)).Decode(tt.target)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(tt.target, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, tt.target)
+			}
+		})
+	}
+}
+
+func TestDecoder_Overflow(t *testing.T) {
+	type Server struct {
+		Port int8 `yaml:"port"`
+	}
+	type Config struct {
+		Servers []Server `yaml:"servers"`
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		target  interface{}
+		wantErr string
 	}{
 		{
-			name:      "invalid yaml",
-			input:     "key: : value",
-			target:    new(map[string]interface{}),
-			wantError: false, // May not error depending on parser
+			name:    "int8 overflow",
+			input:   "300",
+			target:  new(int8),
+			wantErr: "cannot decode 300 into int8: value out of range",
 		},
 		{
-			name:      "type mismatch",
-			input:     "notanumber",
-			target:    new(int),
-			wantError: true,
+			name:    "uint8 overflow",
+			input:   "256",
+			target:  new(uint8),
+			wantErr: "cannot decode 256 into uint8: value out of range",
 		},
 		{
-			name:      "undefined alias",
-			input:     "value: *undefined",
-			target:    new(map[string]interface{}),
-			wantError: true,
+			name:    "hex into int64",
+			input:   "0xFFFFFFFFFFFFFFFF",
+			target:  new(int64),
+			wantErr: "cannot decode 0xFFFFFFFFFFFFFFFF into int64: value out of range",
+		},
+		{
+			name:    "float32 overflow",
+			input:   "1e40",
+			target:  new(float32),
+			wantErr: "cannot decode 1e40 into float32: value out of range",
+		},
+		{
+			name:    "nested field path",
+			input:   "servers:\n  - port: 80\n  - port: 300",
+			target:  new(Config),
+			wantErr: "servers[1].port: cannot decode 300 into int8: value out of range",
+		},
+		{
+			name:    "map value path",
+			input:   "a: 1\nb: 1000",
+			target:  new(map[string]int8),
+			wantErr: "b: cannot decode 1000 into int8: value out of range",
 		},
 	}
 
@@ -540,17 +1884,25 @@ func TestDecoder_ErrorCases(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			dec := NewDecoder(strings.NewReader(tt.input))
 			err := dec.Decode(tt.target)
-
-			if tt.wantError && err == nil {
-				t.Error("expected error but got none")
-			} else if !tt.wantError && err != nil {
-				// Some errors are acceptable
-				if err.Error() != "cannot unmarshal" && !strings.Contains(err.Error(), "cannot decode") {
-					// Ignore expected conversion errors
-				}
+			if err == nil {
+				t.Fatalf("expected error %q, got none", tt.wantErr)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %q", tt.wantErr, err.Error())
 			}
 		})
 	}
+
+	t.Run("hex into uint64", func(t *testing.T) {
+		var result uint64
+		dec := NewDecoder(strings.NewReader("0xFFFFFFFFFFFFFFFF"))
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if result != math.MaxUint64 {
+			t.Errorf("expected %d, got %d", uint64(math.MaxUint64), result)
+		}
+	})
 }
 
 func TestDecoder_ComplexDocument(t *testing.T) {
@@ -687,4 +2039,397 @@ features:
 		dec := NewDecoder(strings.NewReader(input))
 		dec.Decode(&result)
 	}
-}
\ No newline at end of file
+}
+
+func TestDecoder_ColonsInPlainScalars(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"url", "url: http://x", map[string]interface{}{"url": "http://x"}},
+		{"ratio", "ratio: 3:4", map[string]interface{}{"ratio": "3:4"}},
+		{"time", "time: 12:30:00", map[string]interface{}{"time": "12:30:00"}},
+		{"ipv6", "ipv6: ::1", map[string]interface{}{"ipv6": "::1"}},
+		{"words", "k: a:b c:d", map[string]interface{}{"k": "a:b c:d"}},
+		{"key with colon", "a:b: c", map[string]interface{}{"a:b": "c"}},
+		{"sequence items", "- 12:30\n- http://z", []interface{}{"12:30", "http://z"}},
+		{"flow sequence", "k: [http://x, 3:4]", map[string]interface{}{"k": []interface{}{"http://x", "3:4"}}},
+		{"flow mapping", "k: {t: 12:30, u: http://y}", map[string]interface{}{"k": map[string]interface{}{"t": "12:30", "u": "http://y"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result interface{}
+			if err := Unmarshal([]byte(tt.input), &result); err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecoder_MultiLinePlainScalars(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"two lines", "k: this is\n  continued\nb: x", map[string]interface{}{"k": "this is continued", "b": "x"}},
+		{"empty line", "k: a\n  b\n\n  c", map[string]interface{}{"k": "a b\nc"}},
+		{"value on next line", "k:\n  a b\n  c d", map[string]interface{}{"k": "a b c d"}},
+		{"sequence item", "- a\n  b\n- c", []interface{}{"a b", "c"}},
+		{"nested key", "k: a\n  b\nn:\n  m: c\n    d", map[string]interface{}{"k": "a b", "n": map[string]interface{}{"m": "c d"}}},
+		{"stops at comment", "k: a\n  # note\nb: x", map[string]interface{}{"k": "a", "b": "x"}},
+		{"stops at dedent", "n:\n  k: a\n  b: c", map[string]interface{}{"n": map[string]interface{}{"k": "a", "b": "c"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result interface{}
+			if err := Unmarshal([]byte(tt.input), &result); err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecoder_ScalarHook(t *testing.T) {
+	t.Setenv("YAML_TEST_HOST", "db.internal")
+	t.Setenv("YAML_TEST_PORT", "5432")
+
+	expandEnv := func(tag, value string) (string, bool) {
+		if tag != "!!str" || !strings.Contains(value, "${") {
+			return "", false
+		}
+		return os.ExpandEnv(value), true
+	}
+
+	input := `host: ${YAML_TEST_HOST}
+port: ${YAML_TEST_PORT}
+url: "postgres://${YAML_TEST_HOST}:${YAML_TEST_PORT}"
+name: app`
+
+	var typed struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+		URL  string `yaml:"url"`
+		Name string `yaml:"name"`
+	}
+	decoder := NewDecoder(strings.NewReader(input))
+	decoder.SetScalarHook(expandEnv)
+	if err := decoder.Decode(&typed); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if typed.Host != "db.internal" || typed.Port != 5432 ||
+		typed.URL != "postgres://db.internal:5432" || typed.Name != "app" {
+		t.Errorf("unexpected result: %+v", typed)
+	}
+
+	var generic map[string]interface{}
+	decoder = NewDecoder(strings.NewReader(input))
+	decoder.SetScalarHook(expandEnv)
+	if err := decoder.Decode(&generic); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"host": "db.internal",
+		"port": "5432",
+		"url":  "postgres://db.internal:5432",
+		"name": "app",
+	}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("expected %#v, got %#v", expected, generic)
+	}
+}
+
+func TestDecoder_Arrays(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		strict    bool
+		expected  [3]int
+		wantError bool
+	}{
+		{"exact length", "[1, 2, 3]", false, [3]int{1, 2, 3}, false},
+		{"shorter zeroes the rest", "[1, 2]", false, [3]int{1, 2, 0}, false},
+		{"longer", "[1, 2, 3, 4]", false, [3]int{}, true},
+		{"strict exact length", "[1, 2, 3]", true, [3]int{1, 2, 3}, false},
+		{"strict shorter", "[1, 2]", true, [3]int{}, true},
+		{"strict longer", "[1, 2, 3, 4]", true, [3]int{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := [3]int{9, 9, 9}
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.SetStrictArrays(tt.strict)
+			err := dec.Decode(&result)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error, got %v", result)
+				}
+				if !strings.Contains(err.Error(), "into [3]int") {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecoder_SequenceItemAnchors(t *testing.T) {
+	type Service struct {
+		Name string `yaml:"name"`
+		Port int    `yaml:"port"`
+		TLS  bool   `yaml:"tls"`
+	}
+
+	input := `- &web {name: web, port: 80}
+- *web
+- &base
+  port: 8080
+  tls: true
+- <<: *base
+  name: api
+- <<: [*web, *base]
+  tls: false`
+
+	var generic []interface{}
+	if err := Unmarshal([]byte(input), &generic); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "web", "port": int64(80)},
+		map[string]interface{}{"name": "web", "port": int64(80)},
+		map[string]interface{}{"port": int64(8080), "tls": true},
+		map[string]interface{}{"name": "api", "port": int64(8080), "tls": true},
+		map[string]interface{}{"name": "web", "port": int64(80), "tls": false},
+	}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, generic)
+	}
+
+	// The alias decodes to a copy, not to the anchored value itself
+	generic[1].(map[string]interface{})["name"] = "changed"
+	if generic[0].(map[string]interface{})["name"] != "web" {
+		t.Errorf("modifying the aliased item changed the anchored one: %v", generic[0])
+	}
+
+	var typed []Service
+	if err := Unmarshal([]byte(input), &typed); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	expectedTyped := []Service{
+		{Name: "web", Port: 80},
+		{Name: "web", Port: 80},
+		{Port: 8080, TLS: true},
+		{Name: "api", Port: 8080, TLS: true},
+		{Name: "web", Port: 80},
+	}
+	if !reflect.DeepEqual(typed, expectedTyped) {
+		t.Errorf("expected %+v, got %+v", expectedTyped, typed)
+	}
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode error: %v", err)
+	}
+	out, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode error: %v", err)
+	}
+	for _, want := range []string{"- &web {name: web, port: 80}\n", "- *web\n", "<<: *base"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected round trip to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestDecoder_MergeKeyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"scalar value", "a: 1\nb:\n  <<: 1", "merge key value must be a mapping"},
+		{"scalar in sequence", "b:\n  <<: [1]", "merge key sequence must contain only mappings"},
+	}
+
+	// nested targets decode the mapping as the single item of a sequence.
+	targets := []struct {
+		name   string
+		nested bool
+		new    func() interface{}
+	}{
+		{"map", false, func() interface{} { return new(map[string]interface{}) }},
+		{"interface", false, func() interface{} { return new(interface{}) }},
+		{"MapSlice", false, func() interface{} { return new(MapSlice) }},
+		{"sequence item", true, func() interface{} { return new(map[string][]interface{}) }},
+	}
+
+	for _, tt := range tests {
+		for _, target := range targets {
+			t.Run(tt.name+"/"+target.name, func(t *testing.T) {
+				input := tt.input
+				if target.nested {
+					input = "items:\n  - " + strings.ReplaceAll(input, "\n", "\n    ")
+				}
+				err := Unmarshal([]byte(input), target.new())
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("expected error containing %q, got %v", tt.want, err)
+				}
+			})
+		}
+	}
+}
+
+func TestDecoder_RawNode(t *testing.T) {
+	type Deployment struct {
+		Replicas int `yaml:"replicas"`
+		Image    struct {
+			Name string `yaml:"name"`
+			Tag  string `yaml:"tag"`
+		} `yaml:"image"`
+		Ports []int `yaml:"ports"`
+	}
+	type Resource struct {
+		Kind string          `yaml:"kind"`
+		Spec RawNode         `yaml:"spec"`
+		Meta json.RawMessage `yaml:"meta"`
+	}
+
+	input := `kind: deployment
+spec:
+  replicas: 3
+  image:
+    name: web
+    tag: "1.2"
+  ports: [80, 443]
+meta:
+  labels: {app: web}
+  enabled: true`
+
+	var resource Resource
+	if err := Unmarshal([]byte(input), &resource); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if resource.Kind != "deployment" {
+		t.Errorf("expected kind deployment, got %q", resource.Kind)
+	}
+	if _, ok := resource.Spec.Node.(*ast.Mapping); !ok {
+		t.Fatalf("expected spec to capture a mapping, got %T", resource.Spec.Node)
+	}
+
+	var deployment Deployment
+	if err := resource.Spec.Decode(&deployment); err != nil {
+		t.Fatalf("decoding spec: %v", err)
+	}
+	if deployment.Replicas != 3 || deployment.Image.Name != "web" || deployment.Image.Tag != "1.2" ||
+		!reflect.DeepEqual(deployment.Ports, []int{80, 443}) {
+		t.Errorf("unexpected spec: %+v", deployment)
+	}
+
+	if want := `{"enabled":true,"labels":{"app":"web"}}`; string(resource.Meta) != want {
+		t.Errorf("expected meta %s, got %s", want, resource.Meta)
+	}
+
+	out, err := Marshal(resource)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if strings.Contains(string(out), "!!binary") {
+		t.Errorf("expected meta to be written as YAML, got:\n%s", out)
+	}
+	var roundTrip struct {
+		Spec Deployment `yaml:"spec"`
+	}
+	if err := Unmarshal(out, &roundTrip); err != nil {
+		t.Fatalf("unmarshal of marshaled output: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(roundTrip.Spec, deployment) {
+		t.Errorf("expected spec to round trip, got %+v from:\n%s", roundTrip.Spec, out)
+	}
+
+	var again Resource
+	if err := Unmarshal(out, &again); err != nil {
+		t.Fatalf("unmarshal of marshaled output: %v\n%s", err, out)
+	}
+	if string(again.Meta) != string(resource.Meta) {
+		t.Errorf("expected meta %s to round trip, got %s from:\n%s", resource.Meta, again.Meta, out)
+	}
+}
+
+func TestDecoder_RawNodePolymorphic(t *testing.T) {
+	type HTTPCheck struct {
+		URL    string `yaml:"url"`
+		Status int    `yaml:"status"`
+	}
+	type TCPCheck struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+	type Check struct {
+		Kind string  `yaml:"kind"`
+		Spec RawNode `yaml:"spec"`
+	}
+
+	input := `- kind: http
+  spec:
+    url: http://localhost/health
+    status: 200
+- kind: tcp
+  spec:
+    host: db
+    port: 5432`
+
+	var checks []Check
+	if err := Unmarshal([]byte(input), &checks); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	var specs []interface{}
+	for _, check := range checks {
+		var spec interface{}
+		switch check.Kind {
+		case "http":
+			spec = &HTTPCheck{}
+		case "tcp":
+			spec = &TCPCheck{}
+		default:
+			t.Fatalf("unexpected kind %q", check.Kind)
+		}
+		if err := check.Spec.Decode(spec); err != nil {
+			t.Fatalf("decoding %s spec: %v", check.Kind, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	expected := []interface{}{
+		&HTTPCheck{URL: "http://localhost/health", Status: 200},
+		&TCPCheck{Host: "db", Port: 5432},
+	}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, specs)
+	}
+
+	var missing Check
+	if err := Unmarshal([]byte("kind: none"), &missing); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	var target TCPCheck
+	if err := missing.Spec.Decode(&target); err != nil || target != (TCPCheck{}) {
+		t.Errorf("expected an absent spec to decode to the zero value, got %+v, %v", target, err)
+	}
+}
@@ -1,7 +1,10 @@
 package yaml
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
@@ -14,14 +17,89 @@ import (
 )
 
 type Encoder struct {
-	writer io.Writer
-	indent int
+	writer    *streamWriter
+	indent    int
+	seqIndent int
+	compact   bool
+
+	flowTrailingComma bool
+	keyTransform      func(string) string
+	sortMapKeys       bool
+	lineWidth         int
+	stringStyle       ast.ScalarStyle
+	useStringer       bool
+	boolStyle         BoolStyle
+	documents         int
+	autoAnchor        bool
+	omap              bool
+	explicitStart     bool
+	explicitEnd       bool
+	omitEmptyDerefs   bool
+	nullStyle         NullStyle
+	normalizeBools    bool
 }
 
+// streamWriter buffers encoder output and remembers the last byte written,
+// so a document can be terminated without re-reading what was written.
+type streamWriter struct {
+	*bufio.Writer
+	last    byte
+	written int
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.last = p[len(p)-1]
+		w.written += len(p)
+	}
+	return w.Writer.Write(p)
+}
+
+// EncoderOptions bundles encoder settings for MarshalWithOptions.
+type EncoderOptions struct {
+	// Indent is the number of spaces per nesting level. Zero means 2.
+	Indent int
+
+	// LineWidth is the width long strings are folded at. Zero disables
+	// folding.
+	LineWidth int
+
+	// DefaultStringStyle is the style of strings that need no quoting,
+	// e.g. ast.DoubleQuotedStyle to quote every string.
+	DefaultStringStyle ast.ScalarStyle
+
+	// KeepMapOrder writes map keys in Go's map iteration order instead of
+	// sorting them as Marshal does, as with Encoder.SetSortMapKeys(false).
+	KeepMapOrder bool
+
+	// NormalizeBooleans writes boolean values as true or false, as with
+	// Encoder.SetNormalizeBooleans.
+	NormalizeBooleans bool
+
+	// OmitEmptyDerefsPointers makes ,omitempty drop pointers to zero
+	// values, as with Encoder.SetOmitEmptyDerefsPointers.
+	OmitEmptyDerefsPointers bool
+}
+
+// NullStyle selects how the encoder writes nil values.
+type NullStyle int
+
+const (
+	// NullWord writes null. It is the default.
+	NullWord NullStyle = iota
+	// NullTilde writes ~.
+	NullTilde
+	// NullEmpty leaves block mapping values empty, as in "key:". Nulls in
+	// other positions are written as null.
+	NullEmpty
+)
+
 func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{
-		writer: w,
-		indent: 2,
+		writer:      &streamWriter{Writer: bufio.NewWriter(w)},
+		indent:      2,
+		seqIndent:   -1,
+		sortMapKeys: true,
 	}
 }
 
@@ -29,52 +107,363 @@ func (e *Encoder) SetIndent(spaces int) {
 	e.indent = spaces
 }
 
+// SetSequenceIndent sets how many spaces block sequence items are indented
+// relative to their parent mapping key. Zero keeps the dashes flush with the
+// key. By default sequences follow the regular indent.
+func (e *Encoder) SetSequenceIndent(spaces int) {
+	e.seqIndent = spaces
+}
+
+// SetFlowTrailingComma makes flow sequences and mappings end with a comma
+// after their last entry, e.g. [1, 2, 3,].
+func (e *Encoder) SetFlowTrailingComma(enabled bool) {
+	e.flowTrailingComma = enabled
+}
+
+// SetKeyTransform sets a function applied to struct field names that have no
+// name in their yaml tag, e.g. to emit snake_case keys. Tagged names are
+// written unchanged.
+func (e *Encoder) SetKeyTransform(fn func(string) string) {
+	e.keyTransform = fn
+}
+
+// SetUseStringer makes values implementing fmt.Stringer encode as the string
+// returned by their String method. Marshaler still takes precedence, and
+// types without a String method encode as usual.
+func (e *Encoder) SetUseStringer(enabled bool) {
+	e.useStringer = enabled
+}
+
+// SetBoolStyle selects which strings are quoted to keep them from reading
+// back as booleans. With BoolCore12, yes/no/on/off are written unquoted;
+// any other style, including the default, quotes them.
+func (e *Encoder) SetBoolStyle(style BoolStyle) {
+	e.boolStyle = style
+}
+
+// SetAutoAnchor makes Encode write repeated mappings and sequences once,
+// anchored as &auto1, &auto2 and so on, and refer to later identical copies
+// with aliases.
+func (e *Encoder) SetAutoAnchor(enabled bool) {
+	e.autoAnchor = enabled
+}
+
+// SetOmap makes MapSlice values encode as !!omap, a sequence of
+// single-entry mappings, so that their order is part of the document rather
+// than a property of this encoder. Decoding an !!omap into a MapSlice
+// restores the items in order.
+func (e *Encoder) SetOmap(enabled bool) {
+	e.omap = enabled
+}
+
+// SetExplicitDocumentStart makes every document begin with a "---" marker,
+// including the first one of the stream.
+func (e *Encoder) SetExplicitDocumentStart(enabled bool) {
+	e.explicitStart = enabled
+}
+
+// SetExplicitDocumentEnd makes every document end with a "..." marker.
+func (e *Encoder) SetExplicitDocumentEnd(enabled bool) {
+	e.explicitEnd = enabled
+}
+
+// SetOmitEmptyDerefsPointers controls how ,omitempty treats pointers. By
+// default a field is omitted only if its pointer is nil or points to a
+// zero struct, so a *string pointing to "" is written as "". When enabled,
+// pointers are followed and the field is omitted if the value they point
+// to is empty.
+func (e *Encoder) SetOmitEmptyDerefsPointers(enabled bool) {
+	e.omitEmptyDerefs = enabled
+}
+
+// SetNormalizeBooleans makes EncodeNode write boolean values spelled yes,
+// on, No, OFF and so on as true or false. By default scalars keep the
+// spelling they were parsed with. Mapping keys are never rewritten, so a
+// key such as "on" keeps its meaning for readers that treat it as a string.
+// Only spellings that are booleans for the document are rewritten, matching
+// the decoder: yes/no/on/off are rewritten only under a %YAML 1.1 directive
+// or, without a directive, with SetBoolStyle(BoolLegacy11).
+func (e *Encoder) SetNormalizeBooleans(enabled bool) {
+	e.normalizeBools = enabled
+}
+
+// coreBools reports whether node is read with YAML 1.2 core schema
+// booleans, where yes/no/on/off are strings.
+func (e *Encoder) coreBools(node ast.Node) bool {
+	if doc, ok := node.(*ast.Document); ok && doc.Version != "" {
+		return doc.Version == "1.2"
+	}
+	return e.boolStyle != BoolLegacy11
+}
+
+// normalizeBooleans returns a copy of node with plain boolean values
+// spelled true or false. With core set, only true and false in other cases
+// count as booleans.
+func normalizeBooleans(node ast.Node, core bool) ast.Node {
+	node = node.Clone()
+	ast.Walk(node, func(_ string, n ast.Node) bool {
+		scalar, ok := n.(*ast.Scalar)
+		if !ok || scalar.Style != ast.PlainStyle || scalar.Tag() != "!!bool" {
+			return true
+		}
+		switch value := strings.ToLower(scalar.Value); {
+		case value == "true", !core && (value == "yes" || value == "on"):
+			scalar.Value = "true"
+		case value == "false", !core && (value == "no" || value == "off"):
+			scalar.Value = "false"
+		}
+		return true
+	})
+	return node
+}
+
+// SetNullStyle selects how nil pointers, maps, slices and interfaces are
+// written.
+func (e *Encoder) SetNullStyle(style NullStyle) {
+	e.nullStyle = style
+}
+
+func (e *Encoder) nullNode() *ast.Scalar {
+	switch e.nullStyle {
+	case NullTilde:
+		return ast.NewScalar("~")
+	case NullEmpty:
+		node := ast.NewScalar("")
+		node.SetTag("!!null")
+		return node
+	}
+	return ast.NewScalar("null")
+}
+
+// SetSortMapKeys controls whether map keys are written in sorted order, the
+// default. When disabled, keys follow Go's map iteration order. MapSlice
+// values always keep their own order.
+func (e *Encoder) SetSortMapKeys(enabled bool) {
+	e.sortMapKeys = enabled
+}
+
+func (e *Encoder) sequenceIndent() int {
+	if e.seqIndent < 0 {
+		return e.indent
+	}
+	return e.seqIndent
+}
+
 func (e *Encoder) Encode(v interface{}) error {
-	node, err := e.valueToNode(reflect.ValueOf(v))
+	node, err := e.valueToNode(reflect.ValueOf(v), "")
 	if err != nil {
 		return err
 	}
+	if e.autoAnchor {
+		var seen []ast.Node
+		node = anchorDuplicates(node, &seen)
+	}
 	return e.EncodeNode(node)
 }
 
+// anchorDuplicates replaces every non-empty mapping or sequence under node
+// that is identical to one seen earlier in document order with an alias to
+// it, anchoring the first occurrence.
+func anchorDuplicates(node ast.Node, seen *[]ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.Mapping:
+		if len(n.Content) == 0 {
+			return node
+		}
+	case *ast.Sequence:
+		if len(n.Content) == 0 {
+			return node
+		}
+	default:
+		return node
+	}
+
+	for _, prev := range *seen {
+		if identicalNodes(prev, node) {
+			if prev.Anchor() == "" {
+				prev.SetAnchor(fmt.Sprintf("auto%d", countAnchors(*seen)+1))
+			}
+			alias := ast.NewAlias(prev.Anchor())
+			alias.Value = prev
+			return alias
+		}
+	}
+	*seen = append(*seen, node)
+
+	switch n := node.(type) {
+	case *ast.Mapping:
+		for _, entry := range n.Content {
+			entry.Value = anchorDuplicates(entry.Value, seen)
+		}
+	case *ast.Sequence:
+		for i, item := range n.Content {
+			n.Content[i] = anchorDuplicates(item, seen)
+		}
+	}
+	return node
+}
+
+// identicalNodes reports whether a and b would be written identically, apart
+// from anchors. Unlike ast.Equal it compares tags, styles and mapping order
+// exactly, so "1" and 1 are never merged into one anchor.
+func identicalNodes(a, b ast.Node) bool {
+	if alias, ok := a.(*ast.Alias); ok && alias.Value != nil {
+		a = alias.Value
+	}
+	if alias, ok := b.(*ast.Alias); ok && alias.Value != nil {
+		b = alias.Value
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Kind() != b.Kind() || a.Tag() != b.Tag() {
+		return false
+	}
+
+	switch x := a.(type) {
+	case *ast.Scalar:
+		y := b.(*ast.Scalar)
+		return x.Style == y.Style && x.Value == y.Value
+	case *ast.Sequence:
+		y := b.(*ast.Sequence)
+		if x.Style != y.Style || len(x.Content) != len(y.Content) {
+			return false
+		}
+		for i := range x.Content {
+			if !identicalNodes(x.Content[i], y.Content[i]) {
+				return false
+			}
+		}
+		return true
+	case *ast.Mapping:
+		y := b.(*ast.Mapping)
+		if x.Style != y.Style || len(x.Content) != len(y.Content) {
+			return false
+		}
+		for i := range x.Content {
+			if !identicalNodes(x.Content[i].Key, y.Content[i].Key) ||
+				!identicalNodes(x.Content[i].Value, y.Content[i].Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return ast.Equal(a, b)
+	}
+}
+
+func countAnchors(nodes []ast.Node) int {
+	count := 0
+	for _, node := range nodes {
+		if node.Anchor() != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// EncodeNode writes node as a YAML document. Output is streamed through a
+// buffer as it is produced and reaches the underlying writer only as the
+// buffer fills, or on Flush or Close, which callers must invoke when done.
+// Because output is streamed, a call that fails may leave part of its
+// document written. Each call after the first starts a new document,
+// separated from the previous one by "---"; see SetExplicitDocumentStart to
+// mark the first document as well.
 func (e *Encoder) EncodeNode(node ast.Node) error {
-	var buf bytes.Buffer
-	if err := e.encodeNode(&buf, node, 0, false); err != nil {
+	w := e.writer
+	if e.documents > 0 {
+		fmt.Fprint(w, "\n---\n")
+	} else if e.explicitStart {
+		fmt.Fprint(w, "---\n")
+	}
+
+	if e.normalizeBools && node != nil {
+		node = normalizeBooleans(node, e.coreBools(node))
+	}
+
+	start := w.written
+	if !e.compact {
+		e.writeRootAnchor(w, node)
+	}
+	if err := e.encodeNode(w, node, 0, e.compact); err != nil {
 		return err
 	}
-	_, err := e.writer.Write(buf.Bytes())
-	return err
+	if !e.compact && w.written > start && w.last != '\n' {
+		fmt.Fprint(w, "\n")
+	}
+	if e.explicitEnd {
+		if w.written > 0 && w.last != '\n' {
+			fmt.Fprint(w, "\n")
+		}
+		fmt.Fprint(w, "...\n")
+	}
+	e.documents++
+	return nil
+}
+
+// Flush writes any buffered output to the underlying writer and returns
+// the first error encountered while writing.
+func (e *Encoder) Flush() error {
+	return e.writer.Flush()
+}
+
+// Close flushes any buffered output. The encoder should not be used after
+// it is closed.
+func (e *Encoder) Close() error {
+	return e.Flush()
 }
 
-func (e *Encoder) valueToNode(v reflect.Value) (ast.Node, error) {
+// valueToNode converts v to a node. path locates v within the value being
+// encoded, such as ".settings.hosts[0]", and is reported in errors.
+func (e *Encoder) valueToNode(v reflect.Value, path string) (ast.Node, error) {
 	if !v.IsValid() {
-		return ast.NewScalar("null"), nil
+		return e.nullNode(), nil
 	}
 
-	if v.Kind() == reflect.Ptr {
-		if v.IsNil() {
-			return ast.NewScalar("null"), nil
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return e.nullNode(), nil
+	}
+
+	if v.Type() == rawNodeType {
+		node := v.Interface().(RawNode).Node
+		if doc, ok := node.(*ast.Document); ok {
+			node = nil
+			if len(doc.Content) > 0 {
+				node = doc.Content[0]
+			}
+		}
+		if node == nil {
+			return e.nullNode(), nil
 		}
-		return e.valueToNode(v.Elem())
+		return node, nil
 	}
 
-	if v.Kind() == reflect.Interface {
-		if v.IsNil() {
-			return ast.NewScalar("null"), nil
+	if v.Type() == jsonRawMessageType {
+		return e.jsonToNode(v.Bytes(), path)
+	}
+
+	if marshaler, ok := asMarshaler(v); ok {
+		value, err := marshaler.MarshalYAML()
+		if err != nil {
+			return nil, err
 		}
-		return e.valueToNode(v.Elem())
+		return e.valueToNode(reflect.ValueOf(value), path)
 	}
 
-	if v.CanInterface() {
-		if marshaler, ok := v.Interface().(Marshaler); ok {
-			value, err := marshaler.MarshalYAML()
-			if err != nil {
-				return nil, err
-			}
-			return e.valueToNode(reflect.ValueOf(value))
+	if v.Type() == jsonNumberType {
+		return e.jsonNumberToNode(json.Number(v.String())), nil
+	}
+
+	if e.useStringer && v.Kind() != reflect.Interface && v.CanInterface() {
+		if stringer, ok := v.Interface().(fmt.Stringer); ok {
+			return e.createStringNode(stringer.String()), nil
 		}
 	}
 
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		return e.valueToNode(v.Elem(), path)
+	}
+
 	switch v.Kind() {
 	case reflect.Bool:
 		return ast.NewScalar(strconv.FormatBool(v.Bool())), nil
@@ -82,7 +471,7 @@ func (e *Encoder) valueToNode(v reflect.Value) (ast.Node, error) {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return ast.NewScalar(strconv.FormatInt(v.Int(), 10)), nil
 
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return ast.NewScalar(strconv.FormatUint(v.Uint(), 10)), nil
 
 	case reflect.Float32, reflect.Float64:
@@ -104,19 +493,91 @@ func (e *Encoder) valueToNode(v reflect.Value) (ast.Node, error) {
 		return e.createStringNode(v.String()), nil
 
 	case reflect.Slice, reflect.Array:
-		return e.valueToSequence(v)
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 && !v.IsNil() {
+			return binaryToNode(v.Bytes()), nil
+		}
+		if items, ok := v.Interface().(MapSlice); ok {
+			if e.omap {
+				return e.mapSliceToOmap(items, path)
+			}
+			return e.mapSliceToMapping(items, path)
+		}
+		return e.valueToSequence(v, path)
 
 	case reflect.Map:
-		return e.valueToMapping(v)
+		return e.valueToMapping(v, path)
 
 	case reflect.Struct:
-		return e.structToMapping(v)
+		return e.structToMapping(v, path)
 
 	default:
-		return nil, fmt.Errorf("unsupported type: %s", v.Kind())
+		if path == "" {
+			return nil, fmt.Errorf("unsupported type %s", v.Type())
+		}
+		return nil, fmt.Errorf("unsupported type %s at %s", v.Type(), path)
 	}
 }
 
+// jsonToNode writes a json.RawMessage as the YAML equivalent of the JSON it
+// holds, keeping numbers exact. An empty message is written as null.
+func (e *Encoder) jsonToNode(data []byte, path string) (ast.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return e.nullNode(), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		if path == "" {
+			return nil, fmt.Errorf("invalid json.RawMessage: %v", err)
+		}
+		return nil, fmt.Errorf("invalid json.RawMessage at %s: %v", path, err)
+	}
+	return e.valueToNode(reflect.ValueOf(value), path)
+}
+
+// binaryToNode writes data as a !!binary scalar holding base64 in a literal
+// block, wrapped at 76 characters.
+func binaryToNode(data []byte) ast.Node {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines []string
+	for len(encoded) > 76 {
+		lines = append(lines, encoded[:76])
+		encoded = encoded[76:]
+	}
+	lines = append(lines, encoded)
+
+	node := ast.NewScalar(strings.Join(lines, "\n"))
+	node.SetTag("!!binary")
+	node.Style = ast.LiteralStyle
+	return node
+}
+
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// jsonNumberToNode writes a json.Number as a plain numeric scalar. Values
+// that are not valid numbers are written as strings.
+func (e *Encoder) jsonNumberToNode(n json.Number) ast.Node {
+	if _, err := n.Float64(); err != nil {
+		return e.createStringNode(n.String())
+	}
+	return ast.NewScalar(n.String())
+}
+
+func asMarshaler(v reflect.Value) (Marshaler, bool) {
+	if v.CanInterface() {
+		if marshaler, ok := v.Interface().(Marshaler); ok {
+			return marshaler, true
+		}
+	}
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if marshaler, ok := v.Addr().Interface().(Marshaler); ok {
+			return marshaler, true
+		}
+	}
+	return nil, false
+}
+
 func (e *Encoder) createStringNode(s string) *ast.Scalar {
 	node := ast.NewScalar(s)
 
@@ -126,18 +587,22 @@ func (e *Encoder) createStringNode(s string) *ast.Scalar {
 		} else {
 			node.Style = ast.FoldedStyle
 		}
-	} else if needsQuoting(s) {
+	} else if needsQuoting(s, e.boolStyle) {
 		node.Style = ast.DoubleQuotedStyle
+	} else if e.lineWidth > 0 && len(s) > e.lineWidth && len(foldLine(s, e.lineWidth)) > 1 {
+		node.Style = ast.FoldedStyle
+	} else {
+		node.Style = e.stringStyle
 	}
 
 	return node
 }
 
-func (e *Encoder) valueToSequence(v reflect.Value) (ast.Node, error) {
+func (e *Encoder) valueToSequence(v reflect.Value, path string) (ast.Node, error) {
 	sequence := ast.NewSequence()
 
 	for i := 0; i < v.Len(); i++ {
-		item, err := e.valueToNode(v.Index(i))
+		item, err := e.valueToNode(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
 		if err != nil {
 			return nil, err
 		}
@@ -147,21 +612,57 @@ func (e *Encoder) valueToSequence(v reflect.Value) (ast.Node, error) {
 	return sequence, nil
 }
 
-func (e *Encoder) valueToMapping(v reflect.Value) (ast.Node, error) {
+// valueToMapping encodes map v. A map[K]struct{} is a set, and is written as
+// a !!set mapping whose values are all null.
+func (e *Encoder) valueToMapping(v reflect.Value, path string) (ast.Node, error) {
 	mapping := ast.NewMapping()
+	elem := v.Type().Elem()
+	isSet := elem.Kind() == reflect.Struct && elem.NumField() == 0
+	if isSet {
+		mapping.SetTag("!!set")
+	}
 
 	keys := v.MapKeys()
-	sort.Slice(keys, func(i, j int) bool {
-		return fmt.Sprintf("%v", keys[i].Interface()) < fmt.Sprintf("%v", keys[j].Interface())
-	})
+	if e.sortMapKeys {
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprintf("%v", keys[i].Interface()) < fmt.Sprintf("%v", keys[j].Interface())
+		})
+	}
 
 	for _, key := range keys {
-		keyNode, err := e.valueToNode(key)
+		keyNode, err := e.valueToNode(key, path)
 		if err != nil {
 			return nil, err
 		}
 
-		valueNode, err := e.valueToNode(v.MapIndex(key))
+		var valueNode ast.Node
+		if isSet {
+			valueNode = ast.NewScalar("")
+			valueNode.SetTag("!!null")
+		} else if valueNode, err = e.valueToNode(v.MapIndex(key), fmt.Sprintf("%s.%v", path, key.Interface())); err != nil {
+			return nil, err
+		}
+
+		entry := &ast.MappingEntry{
+			Key:   keyNode,
+			Value: valueNode,
+		}
+		mapping.Content = append(mapping.Content, entry)
+	}
+
+	return mapping, nil
+}
+
+func (e *Encoder) mapSliceToMapping(items MapSlice, path string) (ast.Node, error) {
+	mapping := ast.NewMapping()
+
+	for _, item := range items {
+		keyNode, err := e.valueToNode(reflect.ValueOf(item.Key), path)
+		if err != nil {
+			return nil, err
+		}
+
+		valueNode, err := e.valueToNode(reflect.ValueOf(item.Value), fmt.Sprintf("%s.%v", path, item.Key))
 		if err != nil {
 			return nil, err
 		}
@@ -176,41 +677,87 @@ func (e *Encoder) valueToMapping(v reflect.Value) (ast.Node, error) {
 	return mapping, nil
 }
 
-func (e *Encoder) structToMapping(v reflect.Value) (ast.Node, error) {
+// mapSliceToOmap encodes items as an !!omap sequence with one single-entry
+// mapping per item.
+func (e *Encoder) mapSliceToOmap(items MapSlice, path string) (ast.Node, error) {
+	sequence := ast.NewSequence()
+	sequence.SetTag("!!omap")
+
+	for i, item := range items {
+		mapping, err := e.mapSliceToMapping(MapSlice{item}, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		sequence.Content = append(sequence.Content, mapping)
+	}
+
+	return sequence, nil
+}
+
+// structToMapping encodes the exported fields of struct v. Fields of
+// embedded structs without a yaml name are promoted into the mapping like
+// fields tagged ,inline, and are dropped where a field declared on v itself
+// has the same key.
+func (e *Encoder) structToMapping(v reflect.Value, path string) (ast.Node, error) {
 	mapping := ast.NewMapping()
 	t := v.Type()
+	promoted := make(map[*ast.MappingEntry]bool)
+	declared := make(map[string]bool)
 
 	for i := 0; i < v.NumField(); i++ {
 		field := t.Field(i)
-		if field.PkgPath != "" {
+		if field.PkgPath != "" && !isEmbeddedStruct(field) {
+			continue
+		}
+
+		name, options := parseFieldTag(field.Tag.Get("yaml"))
+		if name == "-" {
 			continue
 		}
 
 		fieldValue := v.Field(i)
-		if !fieldValue.IsValid() || isZeroValue(fieldValue) {
-			if tag := field.Tag.Get("yaml"); strings.Contains(tag, ",omitempty") {
-				continue
+		if options["inline"] || (name == "" && isEmbeddedStruct(field)) {
+			entries, err := e.inlineEntries(fieldValue, path)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				promoted[entry] = true
 			}
+			mapping.Content = append(mapping.Content, entries...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
 		}
 
-		name := field.Name
-		tag := field.Tag.Get("yaml")
-		if tag != "" {
-			parts := strings.Split(tag, ",")
-			if parts[0] == "-" {
-				continue
-			}
-			if parts[0] != "" {
-				name = parts[0]
+		if name == "" {
+			name = field.Name
+			if e.keyTransform != nil {
+				name = e.keyTransform(name)
 			}
 		}
+		declared[name] = true
+
+		if options["omitempty"] && e.isEmpty(fieldValue) {
+			continue
+		}
 
 		keyNode := ast.NewScalar(name)
-		valueNode, err := e.valueToNode(fieldValue)
+		valueNode, err := e.valueToNode(fieldValue, path+"."+name)
 		if err != nil {
 			return nil, err
 		}
 
+		if options["flow"] {
+			switch n := valueNode.(type) {
+			case *ast.Sequence:
+				n.Style = ast.FlowStyle
+			case *ast.Mapping:
+				n.Style = ast.FlowStyle
+			}
+		}
+
 		entry := &ast.MappingEntry{
 			Key:   keyNode,
 			Value: valueNode,
@@ -218,6 +765,17 @@ func (e *Encoder) structToMapping(v reflect.Value) (ast.Node, error) {
 		mapping.Content = append(mapping.Content, entry)
 	}
 
+	if len(promoted) > 0 {
+		content := mapping.Content[:0]
+		for _, entry := range mapping.Content {
+			if promoted[entry] && declared[getNodeStringValue(entry.Key)] {
+				continue
+			}
+			content = append(content, entry)
+		}
+		mapping.Content = content
+	}
+
 	return mapping, nil
 }
 
@@ -233,15 +791,43 @@ func (e *Encoder) encodeNode(w io.Writer, node ast.Node, indent int, inline bool
 			e.writeIndent(w, indent)
 			fmt.Fprintf(w, "# %s\n", line)
 		}
+		// Keep a document comment detached from the first node
+		if _, ok := node.(*ast.Document); ok {
+			fmt.Fprintln(w)
+		}
 	}
 
+	if err := e.encodeContent(w, node, indent, inline); err != nil {
+		return err
+	}
+
+	if comment.LineComment != "" && !e.compact {
+		fmt.Fprintf(w, " # %s", comment.LineComment)
+	}
+
+	if comment.FootComment != "" && !inline {
+		for _, line := range strings.Split(strings.TrimSpace(comment.FootComment), "\n") {
+			fmt.Fprintln(w)
+			e.writeIndent(w, indent)
+			fmt.Fprintf(w, "# %s", line)
+		}
+	}
+
+	return nil
+}
+
+// encodeContent writes node without its comments.
+func (e *Encoder) encodeContent(w io.Writer, node ast.Node, indent int, inline bool) error {
 	switch n := node.(type) {
 	case *ast.Document:
 		for i, content := range n.Content {
 			if i > 0 {
-				fmt.Fprintln(w, "\n---")
+				fmt.Fprint(w, "\n\n---\n")
 			}
-			if err := e.encodeNode(w, content, indent, false); err != nil {
+			if !inline {
+				e.writeRootAnchor(w, content)
+			}
+			if err := e.encodeNode(w, content, indent, inline); err != nil {
 				return err
 			}
 		}
@@ -250,7 +836,8 @@ func (e *Encoder) encodeNode(w io.Writer, node ast.Node, indent int, inline bool
 		if !inline {
 			e.writeIndent(w, indent)
 		}
-		e.encodeScalar(w, n)
+		e.writeAnchor(w, n)
+		e.encodeScalar(w, n, indent)
 
 	case *ast.Sequence:
 		if err := e.encodeSequence(w, n, indent, inline); err != nil {
@@ -272,22 +859,26 @@ func (e *Encoder) encodeNode(w io.Writer, node ast.Node, indent int, inline bool
 		return fmt.Errorf("unknown node type: %T", node)
 	}
 
-	if comment.LineComment != "" {
-		fmt.Fprintf(w, " # %s", comment.LineComment)
+	return nil
+}
+
+// encodeScalar writes scalar. Block scalar content is indented one level
+// deeper than indent, the indentation of the line the scalar starts on.
+func (e *Encoder) encodeScalar(w io.Writer, scalar *ast.Scalar, indent int) {
+	if isExplicitTag(scalar.Tag()) {
+		fmt.Fprintf(w, "%s ", scalar.Tag())
 	}
 
-	if comment.FootComment != "" && !inline {
-		fmt.Fprintln(w)
-		for _, line := range strings.Split(strings.TrimSpace(comment.FootComment), "\n") {
-			e.writeIndent(w, indent)
-			fmt.Fprintf(w, "# %s\n", line)
-		}
+	if e.compact && needsCompactQuoting(scalar) {
+		fmt.Fprintf(w, "%q", scalar.Value)
+		return
 	}
 
-	return nil
-}
+	if scalar.Value == "" && scalar.Tag() == "!!null" {
+		fmt.Fprint(w, "null")
+		return
+	}
 
-func (e *Encoder) encodeScalar(w io.Writer, scalar *ast.Scalar) {
 	switch scalar.Style {
 	case ast.SingleQuotedStyle:
 		fmt.Fprintf(w, "'%s'", strings.ReplaceAll(scalar.Value, "'", "''"))
@@ -298,25 +889,17 @@ func (e *Encoder) encodeScalar(w io.Writer, scalar *ast.Scalar) {
 		if scalar.Value != "" && !strings.HasSuffix(scalar.Value, "\n") {
 			fmt.Fprint(w, "-")
 		}
-		fmt.Fprintln(w)
-		for _, line := range strings.Split(scalar.Value, "\n") {
-			if line != "" {
-				e.writeIndent(w, e.indent)
-				fmt.Fprintln(w, line)
-			}
-		}
+		e.writeBlockLines(w, scalar.Value, indent+e.indent)
 	case ast.FoldedStyle:
 		fmt.Fprint(w, ">")
 		if scalar.Value != "" && !strings.HasSuffix(scalar.Value, "\n") {
 			fmt.Fprint(w, "-")
 		}
-		fmt.Fprintln(w)
-		for _, line := range strings.Split(scalar.Value, "\n") {
-			if line != "" {
-				e.writeIndent(w, e.indent)
-				fmt.Fprintln(w, line)
-			}
+		value := scalar.Value
+		if e.lineWidth > 0 && !strings.Contains(strings.TrimSuffix(value, "\n"), "\n") {
+			value = strings.Join(foldLine(strings.TrimSuffix(value, "\n"), e.lineWidth), "\n")
 		}
+		e.writeBlockLines(w, value, indent+e.indent)
 	default:
 		fmt.Fprint(w, scalar.Value)
 	}
@@ -324,20 +907,38 @@ func (e *Encoder) encodeScalar(w io.Writer, scalar *ast.Scalar) {
 
 func (e *Encoder) encodeSequence(w io.Writer, sequence *ast.Sequence, indent int, inline bool) error {
 	if len(sequence.Content) == 0 {
+		e.writeAnchor(w, sequence)
 		fmt.Fprint(w, "[]")
 		return nil
 	}
 
-	if sequence.Style == ast.FlowStyle || inline {
+	if (sequence.Style == ast.FlowStyle || inline) && !e.compact && hasFlowComments(sequence.Content...) {
+		e.writeAnchor(w, sequence)
+		fmt.Fprint(w, "[")
+		for i, item := range sequence.Content {
+			e.writeFlowHeadComment(w, item, indent+e.indent)
+			if err := e.encodeContent(w, item, indent+e.indent, true); err != nil {
+				return err
+			}
+			e.writeFlowEntryEnd(w, item.GetComment().LineComment, i == len(sequence.Content)-1)
+		}
+		fmt.Fprintln(w)
+		e.writeIndent(w, indent)
+		fmt.Fprint(w, "]")
+	} else if sequence.Style == ast.FlowStyle || inline {
+		e.writeAnchor(w, sequence)
 		fmt.Fprint(w, "[")
 		for i, item := range sequence.Content {
 			if i > 0 {
-				fmt.Fprint(w, ", ")
+				fmt.Fprint(w, e.flowSeparator())
 			}
 			if err := e.encodeNode(w, item, 0, true); err != nil {
 				return err
 			}
 		}
+		if e.flowTrailingComma {
+			fmt.Fprint(w, ",")
+		}
 		fmt.Fprint(w, "]")
 	} else {
 		for i, item := range sequence.Content {
@@ -345,17 +946,19 @@ func (e *Encoder) encodeSequence(w io.Writer, sequence *ast.Sequence, indent int
 				fmt.Fprintln(w)
 			}
 			e.writeIndent(w, indent)
-			fmt.Fprint(w, "- ")
 
-			switch item.(type) {
-			case *ast.Mapping, *ast.Sequence:
+			// A block collection starts on the line after its dash
+			if isBlockCollection(item) {
+				fmt.Fprint(w, "-")
+				fmt.Fprint(w, blockProperties(item))
 				fmt.Fprintln(w)
 				if err := e.encodeNode(w, item, indent+e.indent, false); err != nil {
 					return err
 				}
-			default:
+			} else {
+				fmt.Fprint(w, "- ")
 				var buf bytes.Buffer
-				if err := e.encodeNode(&buf, item, 0, true); err != nil {
+				if err := e.encodeNode(&buf, item, indent, true); err != nil {
 					return err
 				}
 				fmt.Fprint(w, strings.TrimSpace(buf.String()))
@@ -368,24 +971,55 @@ func (e *Encoder) encodeSequence(w io.Writer, sequence *ast.Sequence, indent int
 
 func (e *Encoder) encodeMapping(w io.Writer, mapping *ast.Mapping, indent int, inline bool) error {
 	if len(mapping.Content) == 0 {
+		e.writeAnchor(w, mapping)
 		fmt.Fprint(w, "{}")
 		return nil
 	}
 
-	if mapping.Style == ast.FlowStyle || inline {
+	if (mapping.Style == ast.FlowStyle || inline) && !e.compact && hasFlowEntryComments(mapping.Content) {
+		e.writeAnchor(w, mapping)
 		fmt.Fprint(w, "{")
 		for i, entry := range mapping.Content {
-			if i > 0 {
-				fmt.Fprint(w, ", ")
-			}
-			if err := e.encodeNode(w, entry.Key, 0, true); err != nil {
+			e.writeFlowHeadComment(w, entry.Key, indent+e.indent)
+			if err := e.encodeContent(w, mappingKey(entry.Key), indent+e.indent, true); err != nil {
 				return err
 			}
 			fmt.Fprint(w, ": ")
+			if err := e.encodeContent(w, entry.Value, indent+e.indent, true); err != nil {
+				return err
+			}
+			lineComment := entry.Key.GetComment().LineComment
+			if entry.Value != nil && entry.Value.GetComment().LineComment != "" {
+				lineComment = entry.Value.GetComment().LineComment
+			}
+			e.writeFlowEntryEnd(w, lineComment, i == len(mapping.Content)-1)
+		}
+		fmt.Fprintln(w)
+		e.writeIndent(w, indent)
+		fmt.Fprint(w, "}")
+	} else if mapping.Style == ast.FlowStyle || inline {
+		e.writeAnchor(w, mapping)
+		fmt.Fprint(w, "{")
+		for i, entry := range mapping.Content {
+			if i > 0 {
+				fmt.Fprint(w, e.flowSeparator())
+			}
+			if key, ok := entry.Key.(*ast.Scalar); ok && e.compact {
+				// A quoted key lets the ':' follow it without a space
+				fmt.Fprintf(w, "%q:", key.Value)
+			} else {
+				if err := e.encodeNode(w, mappingKey(entry.Key), 0, true); err != nil {
+					return err
+				}
+				fmt.Fprint(w, ": ")
+			}
 			if err := e.encodeNode(w, entry.Value, 0, true); err != nil {
 				return err
 			}
 		}
+		if e.flowTrailingComma {
+			fmt.Fprint(w, ",")
+		}
 		fmt.Fprint(w, "}")
 	} else {
 		for i, entry := range mapping.Content {
@@ -399,26 +1033,65 @@ func (e *Encoder) encodeMapping(w io.Writer, mapping *ast.Mapping, indent int, i
 					fmt.Fprintf(w, "# %s\n", line)
 				}
 			}
+			if head := entry.Key.GetComment().HeadComment; head != "" {
+				for _, line := range strings.Split(strings.TrimSpace(head), "\n") {
+					e.writeIndent(w, indent)
+					fmt.Fprintf(w, "# %s\n", line)
+				}
+			}
 
 			e.writeIndent(w, indent)
 
 			// Write the key
-			if err := e.encodeNode(w, entry.Key, 0, true); err != nil {
+			if needsExplicitKey(entry.Key) {
+				if err := e.encodeExplicitKey(w, entry.Key, indent); err != nil {
+					return err
+				}
+			} else if err := e.encodeNode(w, mappingKey(entry.Key), 0, true); err != nil {
 				return err
 			}
-			fmt.Fprint(w, ": ")
+			fmt.Fprint(w, ":")
 
 			// Write the value
-			switch entry.Value.(type) {
-			case *ast.Mapping, *ast.Sequence:
+			if isBlockCollection(entry.Value) {
+				childIndent := indent + e.indent
+				if _, ok := entry.Value.(*ast.Sequence); ok {
+					childIndent = indent + e.sequenceIndent()
+				}
+				fmt.Fprint(w, blockProperties(entry.Value))
+				if entry.Comment.LineComment != "" && !e.compact {
+					fmt.Fprintf(w, " # %s", entry.Comment.LineComment)
+				}
 				fmt.Fprintln(w)
-				if err := e.encodeNode(w, entry.Value, indent+e.indent, false); err != nil {
+				if err := e.encodeNode(w, entry.Value, childIndent, false); err != nil {
 					return err
 				}
-			default:
-				if err := e.encodeNode(w, entry.Value, 0, true); err != nil {
+			} else if e.nullStyle == NullEmpty && isEmptyNull(entry.Value) {
+				if entry.Comment.LineComment != "" && !e.compact {
+					fmt.Fprintf(w, " # %s", entry.Comment.LineComment)
+				}
+			} else {
+				fmt.Fprint(w, " ")
+				if err := e.encodeNode(w, entry.Value, indent, true); err != nil {
 					return err
 				}
+				if entry.Comment.LineComment != "" && !e.compact &&
+					(entry.Value == nil || entry.Value.GetComment().LineComment == "") {
+					fmt.Fprintf(w, " # %s", entry.Comment.LineComment)
+				}
+			}
+
+			// A foot comment is a detached block, so a blank line keeps it
+			// from reading as the next key's head comment
+			if entry.Comment.FootComment != "" {
+				for _, line := range strings.Split(strings.TrimSpace(entry.Comment.FootComment), "\n") {
+					fmt.Fprintln(w)
+					e.writeIndent(w, indent)
+					fmt.Fprintf(w, "# %s", line)
+				}
+				if i < len(mapping.Content)-1 {
+					fmt.Fprintln(w)
+				}
 			}
 		}
 	}
@@ -426,20 +1099,260 @@ func (e *Encoder) encodeMapping(w io.Writer, mapping *ast.Mapping, indent int, i
 	return nil
 }
 
+// writeBlockLines writes the lines of a block scalar's content, each on a new
+// line at indent. The final line break is left to the caller.
+func (e *Encoder) writeBlockLines(w io.Writer, value string, indent int) {
+	for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+		fmt.Fprintln(w)
+		if line != "" {
+			e.writeIndent(w, indent)
+			fmt.Fprint(w, line)
+		}
+	}
+}
+
+// foldLine splits s into lines of at most width bytes where possible. It
+// only breaks at a single space between words, which a folded block scalar
+// reads back as that space.
+func foldLine(s string, width int) []string {
+	var lines []string
+	start, lastBreak := 0, -1
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] != ' ' || s[i-1] == ' ' || s[i+1] == ' ' {
+			continue
+		}
+		if i-start > width && lastBreak > start {
+			lines = append(lines, s[start:lastBreak])
+			start = lastBreak + 1
+		}
+		lastBreak = i
+	}
+	if len(s)-start > width && lastBreak > start {
+		lines = append(lines, s[start:lastBreak])
+		start = lastBreak + 1
+	}
+	return append(lines, s[start:])
+}
+
+// hasFlowComments reports whether any of nodes carries a comment that a
+// single-line flow collection has no room for.
+func hasFlowComments(nodes ...ast.Node) bool {
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if comment := node.GetComment(); comment.HeadComment != "" || comment.LineComment != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlowEntryComments(entries []*ast.MappingEntry) bool {
+	for _, entry := range entries {
+		if hasFlowComments(entry.Key, entry.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFlowHeadComment starts a new line for an entry of a multi-line flow
+// collection, preceded by the entry's head comment.
+func (e *Encoder) writeFlowHeadComment(w io.Writer, node ast.Node, indent int) {
+	fmt.Fprintln(w)
+	if node == nil {
+		e.writeIndent(w, indent)
+		return
+	}
+	if head := node.GetComment().HeadComment; head != "" {
+		for _, line := range strings.Split(strings.TrimSpace(head), "\n") {
+			e.writeIndent(w, indent)
+			fmt.Fprintf(w, "# %s\n", line)
+		}
+	}
+	e.writeIndent(w, indent)
+}
+
+// writeFlowEntryEnd writes the separator after an entry of a multi-line flow
+// collection, followed by the entry's line comment.
+func (e *Encoder) writeFlowEntryEnd(w io.Writer, lineComment string, last bool) {
+	if !last || e.flowTrailingComma {
+		fmt.Fprint(w, ",")
+	}
+	if lineComment != "" {
+		fmt.Fprintf(w, " # %s", lineComment)
+	}
+}
+
+// writeAnchor writes the "&name " prefix of an anchored node, followed by
+// the tag of a collection; scalars write their own tag. Block collections
+// are not handled here: their anchor and tag go on the line that introduces
+// them, which the caller writes.
+func (e *Encoder) writeAnchor(w io.Writer, node ast.Node) {
+	if anchor := node.Anchor(); anchor != "" {
+		fmt.Fprintf(w, "&%s ", anchor)
+	}
+	if _, ok := node.(*ast.Scalar); !ok && isExplicitTag(node.Tag()) {
+		fmt.Fprintf(w, "%s ", node.Tag())
+	}
+}
+
+// blockProperties returns the " &name !tag" suffix written on the line that
+// introduces a block collection.
+func blockProperties(node ast.Node) string {
+	var props string
+	if anchor := node.Anchor(); anchor != "" {
+		props += " &" + anchor
+	}
+	if isExplicitTag(node.Tag()) {
+		props += " " + node.Tag()
+	}
+	return props
+}
+
+// writeRootAnchor writes the anchor and tag of a top-level block collection
+// on a line of their own.
+func (e *Encoder) writeRootAnchor(w io.Writer, node ast.Node) {
+	if node != nil && isBlockCollection(node) {
+		if props := blockProperties(node); props != "" {
+			fmt.Fprintln(w, props[1:])
+		}
+	}
+}
+
 func (e *Encoder) writeIndent(w io.Writer, spaces int) {
 	for i := 0; i < spaces; i++ {
 		fmt.Fprint(w, " ")
 	}
 }
 
-func needsQuoting(s string) bool {
+// encodeExplicitKey writes a "? " complex key and leaves the writer at the
+// indentation of the ":" that introduces its value.
+func (e *Encoder) encodeExplicitKey(w io.Writer, key ast.Node, indent int) error {
+	childIndent := indent + e.indent
+	if _, ok := key.(*ast.Scalar); ok {
+		childIndent = indent
+	}
+
+	var buf bytes.Buffer
+	if err := e.encodeNode(&buf, key, childIndent, false); err != nil {
+		return err
+	}
+	fmt.Fprint(w, "? ")
+	fmt.Fprint(w, strings.TrimRight(strings.TrimLeft(buf.String(), " "), "\n"))
+	fmt.Fprintln(w)
+	e.writeIndent(w, indent)
+	return nil
+}
+
+// needsExplicitKey reports whether a key cannot be written in the compact
+// "key:" form: block collections, block scalars, and keys longer than the
+// 1024 characters YAML allows for implicit keys.
+func needsExplicitKey(key ast.Node) bool {
+	if isBlockCollection(key) {
+		return true
+	}
+	if scalar, ok := key.(*ast.Scalar); ok {
+		switch scalar.Style {
+		case ast.LiteralStyle, ast.FoldedStyle:
+			return true
+		}
+		return len(scalar.Value) > 1024
+	}
+	return false
+}
+
+func (e *Encoder) flowSeparator() string {
+	if e.compact {
+		return ","
+	}
+	return ", "
+}
+
+// needsCompactQuoting reports whether a scalar must be double-quoted to stay
+// on one line inside a flow collection.
+func needsCompactQuoting(scalar *ast.Scalar) bool {
+	switch scalar.Style {
+	case ast.LiteralStyle, ast.FoldedStyle:
+		return true
+	case ast.PlainStyle:
+		return strings.ContainsAny(scalar.Value, ",[]{}")
+	}
+	return false
+}
+
+func isBlockCollection(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Mapping:
+		return n.Style == ast.BlockStyle && len(n.Content) > 0
+	case *ast.Sequence:
+		return n.Style == ast.BlockStyle && len(n.Content) > 0
+	}
+	return false
+}
+
+// mappingKey returns key as it should be written, double-quoting plain
+// scalar keys such as "a:b" or " padded" that would not parse back as the
+// same key.
+func mappingKey(key ast.Node) ast.Node {
+	scalar, ok := key.(*ast.Scalar)
+	if !ok || scalar.Style != ast.PlainStyle || !isUnsafePlain(scalar.Value) {
+		return key
+	}
+	if scalar.Value == "" && (scalar.Tag() == "!!null" || scalar.Tag() == "") {
+		return key
+	}
+	quoted := *scalar
+	quoted.Style = ast.DoubleQuotedStyle
+	return &quoted
+}
+
+// isEmptyNull reports whether node is a null written without a value, as
+// produced by NullEmpty.
+func isEmptyNull(node ast.Node) bool {
+	scalar, ok := node.(*ast.Scalar)
+	return ok && scalar.Value == "" && scalar.Tag() == "!!null" && scalar.Anchor() == "" &&
+		scalar.GetComment().LineComment == ""
+}
+
+// isExplicitTag reports whether tag must be written out because the parser
+// would not resolve it from the scalar alone.
+func isExplicitTag(tag string) bool {
+	switch tag {
+	case "", "!!str", "!!int", "!!float", "!!bool", "!!null":
+		return false
+	}
+	return true
+}
+
+// isUnsafePlain reports whether s cannot be written as a plain scalar
+// without changing how it parses: it is empty, contains indicator
+// characters, starts like a sequence entry, explicit key, tag or directive,
+// or has leading or trailing whitespace.
+func isUnsafePlain(s string) bool {
+	if s == "" || strings.ContainsAny(s, ":#@*&[]{}|>'\"\n\r\t") || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch s[0] {
+	case ',', '!', '%', '`':
+		return true
+	case '-', '?':
+		return len(s) == 1 || s[1] == ' '
+	}
+	return false
+}
+
+func needsQuoting(s string, boolStyle BoolStyle) bool {
 	if s == "" {
 		return true
 	}
 
 	specialValues := []string{
-		"true", "false", "yes", "no", "on", "off",
-		"null", "~", ".inf", "-.inf", ".nan",
+		"true", "false", "null", "~", ".inf", "-.inf", ".nan",
+	}
+	if boolStyle != BoolCore12 {
+		specialValues = append(specialValues, "yes", "no", "on", "off")
 	}
 
 	for _, special := range specialValues {
@@ -448,7 +1361,7 @@ func needsQuoting(s string) bool {
 		}
 	}
 
-	if strings.ContainsAny(s, ":#@*&[]{}|>'\"\n\r\t") {
+	if isUnsafePlain(s) {
 		return true
 	}
 
@@ -463,6 +1376,56 @@ func needsQuoting(s string) bool {
 	return false
 }
 
+// inlineEntries returns the mapping entries of a struct or map field tagged
+// ,inline so they can be spliced into the parent mapping.
+func (e *Encoder) inlineEntries(v reflect.Value, path string) ([]*ast.MappingEntry, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	var node ast.Node
+	var err error
+	switch v.Kind() {
+	case reflect.Struct:
+		node, err = e.structToMapping(v, path)
+	case reflect.Map:
+		node, err = e.valueToMapping(v, path)
+	default:
+		return nil, fmt.Errorf("cannot inline field of type %s", v.Type())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return node.(*ast.Mapping).Content, nil
+}
+
+// parseFieldTag splits a yaml struct tag into its name and the set of
+// options that follow it, such as "omitempty".
+func parseFieldTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+	options := make(map[string]bool, len(parts)-1)
+	for _, option := range parts[1:] {
+		options[strings.TrimSpace(option)] = true
+	}
+	return parts[0], options
+}
+
+// isEmpty reports whether a field tagged ,omitempty holding v is omitted.
+func (e *Encoder) isEmpty(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	if e.omitEmptyDerefs {
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+	}
+	return isZeroValue(v)
+}
+
 func isZeroValue(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Bool:
@@ -477,8 +1440,17 @@ func isZeroValue(v reflect.Value) bool {
 		return v.String() == ""
 	case reflect.Slice, reflect.Array, reflect.Map:
 		return v.Len() == 0
-	case reflect.Interface, reflect.Ptr:
+	case reflect.Interface:
 		return v.IsNil()
+	case reflect.Ptr:
+		return v.IsNil() || (v.Elem().Kind() == reflect.Struct && isZeroValue(v.Elem()))
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !isZeroValue(v.Field(i)) {
+				return false
+			}
+		}
+		return true
 	}
 	return false
 }
@@ -2,7 +2,10 @@ package yaml
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"math"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -31,6 +34,9 @@ func TestEncoder_Scalars(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -90,6 +96,9 @@ func TestEncoder_Maps(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -138,7 +147,7 @@ func TestEncoder_Slices(t *testing.T) {
 				[]string{"nested1", "nested2"},
 				"item2",
 			},
-			expected: "- \n  - nested1\n  - nested2\n- item2\n",
+			expected: "-\n  - nested1\n  - nested2\n- item2\n",
 		},
 		{
 			name: "slice with mixed types",
@@ -157,6 +166,9 @@ func TestEncoder_Slices(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -169,6 +181,44 @@ func TestEncoder_Slices(t *testing.T) {
 	}
 }
 
+func TestEncoder_NoTrailingWhitespace(t *testing.T) {
+	input := map[string]interface{}{
+		"matrix": [][]int{{1, 2}, {3, 4}},
+		"servers": []map[string]interface{}{
+			{"name": "a", "ports": []int{80, 443}},
+			{"name": "b", "tags": []string{}},
+		},
+		"script": "line one\n\nline three\n",
+		"nested": map[string]interface{}{"list": []interface{}{[]string{"x"}, "y"}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	for i, line := range strings.Split(buf.String(), "\n") {
+		if strings.TrimRight(line, " \t") != line {
+			t.Errorf("line %d has trailing whitespace: %q\n%s", i+1, line, buf.String())
+		}
+	}
+
+	var decoded map[string]interface{}
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode error: %v\n%s", err, buf.String())
+	}
+	if got := decoded["matrix"]; !reflect.DeepEqual(got, []interface{}{
+		[]interface{}{int64(1), int64(2)},
+		[]interface{}{int64(3), int64(4)},
+	}) {
+		t.Errorf("unexpected matrix %v", got)
+	}
+}
+
 func TestEncoder_Structs(t *testing.T) {
 	type SimpleStruct struct {
 		Name  string `yaml:"name"`
@@ -226,6 +276,9 @@ func TestEncoder_Structs(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -238,6 +291,385 @@ func TestEncoder_Structs(t *testing.T) {
 	}
 }
 
+func TestEncoder_OmitEmpty(t *testing.T) {
+	type Address struct {
+		Street string `yaml:"street"`
+		City   string `yaml:"city"`
+	}
+
+	type Person struct {
+		Name    string            `yaml:"name"`
+		Address Address           `yaml:"address,omitempty"`
+		Billing *Address          `yaml:"billing,omitempty"`
+		Labels  map[string]string `yaml:"labels,omitempty"`
+	}
+
+	tests := []struct {
+		name     string
+		input    Person
+		expected string
+	}{
+		{
+			name: "zero struct and empty map omitted",
+			input: Person{
+				Name:    "Alice",
+				Billing: &Address{},
+				Labels:  map[string]string{},
+			},
+			expected: "name: Alice\n",
+		},
+		{
+			name: "non-empty struct emitted",
+			input: Person{
+				Name:    "Bob",
+				Address: Address{City: "Paris"},
+				Billing: &Address{Street: "Main St"},
+			},
+			expected: "name: Bob\naddress:\n  street: \"\"\n  city: Paris\nbilling:\n  street: Main St\n  city: \"\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			if err := enc.Encode(tt.input); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+
+			result := buf.String()
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEncoder_OmitEmptyPointers(t *testing.T) {
+	type Config struct {
+		Name    string  `yaml:"name"`
+		Comment *string `yaml:"comment,omitempty"`
+		Retries *int    `yaml:"retries,omitempty"`
+	}
+
+	empty, zero, text, three := "", 0, "hi", 3
+
+	tests := []struct {
+		name     string
+		input    Config
+		deref    bool
+		expected string
+	}{
+		{"nil pointers", Config{Name: "a"}, false, "name: a\n"},
+		{"pointers to zero values kept", Config{Name: "a", Comment: &empty, Retries: &zero}, false, "name: a\ncomment: \"\"\nretries: 0\n"},
+		{"pointers to zero values dropped", Config{Name: "a", Comment: &empty, Retries: &zero}, true, "name: a\n"},
+		{"pointers to values kept", Config{Name: "a", Comment: &text, Retries: &three}, true, "name: a\ncomment: hi\nretries: 3\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetOmitEmptyDerefsPointers(tt.deref)
+			if err := enc.Encode(tt.input); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+
+	out, err := MarshalWithOptions(Config{Name: "a", Comment: &empty}, EncoderOptions{OmitEmptyDerefsPointers: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions error: %v", err)
+	}
+	if string(out) != "name: a\n" {
+		t.Errorf("expected comment omitted, got:\n%s", out)
+	}
+}
+
+func TestEncoder_NullStyle(t *testing.T) {
+	input := map[string]interface{}{
+		"a":    nil,
+		"b":    1,
+		"list": []interface{}{nil},
+	}
+
+	tests := []struct {
+		name     string
+		style    NullStyle
+		expected string
+	}{
+		{"word", NullWord, "a: null\nb: 1\nlist:\n  - null\n"},
+		{"tilde", NullTilde, "a: ~\nb: 1\nlist:\n  - ~\n"},
+		{"empty", NullEmpty, "a:\nb: 1\nlist:\n  - null\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetNullStyle(tt.style)
+			if err := enc.Encode(input); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+
+			var decoded map[string]interface{}
+			if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			if value, ok := decoded["a"]; !ok || value != nil {
+				t.Errorf("expected a to decode as null, got %#v", decoded)
+			}
+			if list := decoded["list"].([]interface{}); len(list) != 1 || list[0] != nil {
+				t.Errorf("expected list to decode as [null], got %#v", decoded["list"])
+			}
+		})
+	}
+}
+
+func TestEncoder_FlowTag(t *testing.T) {
+	type Point struct {
+		Name   string         `yaml:"name"`
+		Tags   []string       `yaml:"tags,flow"`
+		Coords []int          `yaml:"coords,flow,omitempty"`
+		Labels map[string]int `yaml:"labels,flow"`
+		Block  []string       `yaml:"block"`
+	}
+
+	input := Point{
+		Name:   "origin",
+		Tags:   []string{"a", "b"},
+		Labels: map[string]int{"y": 2, "x": 1},
+		Block:  []string{"c"},
+	}
+	expected := "name: origin\ntags: [a, b]\nlabels: {x: 1, y: 2}\nblock:\n  - c\n"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	result := buf.String()
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestEncoder_Inline(t *testing.T) {
+	type Metadata struct {
+		Name    string `yaml:"name"`
+		Version string `yaml:"version"`
+	}
+
+	type Resource struct {
+		Kind     string            `yaml:"kind"`
+		Metadata Metadata          `yaml:",inline"`
+		Extra    map[string]string `yaml:",inline"`
+	}
+
+	input := Resource{
+		Kind:     "Service",
+		Metadata: Metadata{Name: "web", Version: "v1"},
+		Extra:    map[string]string{"owner": "ops", "cost": "low"},
+	}
+	expected := "kind: Service\nname: web\nversion: v1\ncost: low\nowner: ops\n"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	result := buf.String()
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestEncoder_EmbeddedStructs(t *testing.T) {
+	type Base struct {
+		ID int
+	}
+	type User struct {
+		Base
+		Name string
+	}
+	type Shadow struct {
+		Base
+		ID string
+	}
+	type Named struct {
+		Base `yaml:"base"`
+		Name string
+	}
+	type base struct {
+		ID int
+	}
+	type Item struct {
+		base
+		Name string
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{"promoted", User{Base{ID: 1}, "x"}, "id: 1\nname: x\n"},
+		{"outer field shadows promoted field", Shadow{Base{ID: 1}, "abc"}, "id: abc\n"},
+		{"named embedded field", Named{Base{ID: 2}, "y"}, "base:\n  id: 2\nname: y\n"},
+		{"unexported embedded type", Item{base{ID: 3}, "z"}, "id: 3\nname: z\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetKeyTransform(strings.ToLower)
+			if err := enc.Encode(tt.input); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestEncoder_MapSlice(t *testing.T) {
+	input := MapSlice{
+		{Key: "zebra", Value: 1},
+		{Key: "apple", Value: MapSlice{
+			{Key: "mango", Value: "x"},
+			{Key: "banana", Value: "y"},
+		}},
+		{Key: "list", Value: []string{"b", "a"}},
+	}
+	expected := "zebra: 1\napple:\n  mango: x\n  banana: y\nlist:\n  - b\n  - a\n"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	result := buf.String()
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestEncoder_SortMapKeys(t *testing.T) {
+	input := map[string]int{"zebra": 1, "apple": 2, "mango": 3}
+
+	t.Run("sorted by default", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		if err := enc.Encode(input); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+		expected := "apple: 2\nmango: 3\nzebra: 1\n"
+		if result := buf.String(); result != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+		}
+	})
+
+	t.Run("unsorted", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetSortMapKeys(false)
+		if err := enc.Encode(input); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected 3 entries, got:\n%s", buf.String())
+		}
+		var decoded map[string]int
+		if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, input) {
+			t.Errorf("expected %v, got %v", input, decoded)
+		}
+	})
+}
+
+func TestEncoder_KeyTransform(t *testing.T) {
+	type Config struct {
+		ServerName string
+		MaxRetries int
+		HTTPPort   int
+		Tagged     string `yaml:"customKey"`
+	}
+
+	snakeCase := func(name string) string {
+		var b strings.Builder
+		for i, r := range name {
+			if r >= 'A' && r <= 'Z' {
+				if i > 0 && (name[i-1] < 'A' || name[i-1] > 'Z' || (i+1 < len(name) && name[i+1] >= 'a' && name[i+1] <= 'z')) {
+					b.WriteByte('_')
+				}
+				r += 'a' - 'A'
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	input := Config{ServerName: "web", MaxRetries: 3, HTTPPort: 8080, Tagged: "x"}
+	expected := "server_name: web\nmax_retries: 3\nhttp_port: 8080\ncustomKey: x\n"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetKeyTransform(snakeCase)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	result := buf.String()
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
 func TestEncoder_Nodes(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -287,6 +719,9 @@ func TestEncoder_Nodes(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.EncodeNode(tt.node)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -299,6 +734,80 @@ func TestEncoder_Nodes(t *testing.T) {
 	}
 }
 
+func TestEncoder_ExplicitKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      ast.Node
+		expected string
+	}{
+		{
+			name:     "simple key",
+			key:      ast.NewScalar("key"),
+			expected: "key: value\n",
+		},
+		{
+			name: "sequence key",
+			key: &ast.Sequence{
+				Content: []ast.Node{
+					ast.NewScalar("a"),
+					ast.NewScalar("b"),
+				},
+			},
+			expected: "? - a\n  - b\n: value\n",
+		},
+		{
+			name: "flow sequence key",
+			key: &ast.Sequence{
+				Style: ast.FlowStyle,
+				Content: []ast.Node{
+					ast.NewScalar("a"),
+					ast.NewScalar("b"),
+				},
+			},
+			expected: "[a, b]: value\n",
+		},
+		{
+			name: "mapping key",
+			key: &ast.Mapping{
+				Content: []*ast.MappingEntry{
+					{Key: ast.NewScalar("x"), Value: ast.NewScalar("1")},
+					{Key: ast.NewScalar("y"), Value: ast.NewScalar("2")},
+				},
+			},
+			expected: "? x: 1\n  y: 2\n: value\n",
+		},
+		{
+			name:     "multi-line key",
+			key:      &ast.Scalar{Value: "line1\nline2\n", Style: ast.LiteralStyle},
+			expected: "? |\n  line1\n  line2\n: value\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &ast.Mapping{
+				Content: []*ast.MappingEntry{
+					{Key: tt.key, Value: ast.NewScalar("value")},
+				},
+			}
+
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			if err := enc.EncodeNode(node); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+
+			result := buf.String()
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestEncoder_ScalarStyles(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -344,6 +853,9 @@ func TestEncoder_ScalarStyles(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.EncodeNode(tt.node)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -402,6 +914,9 @@ func TestEncoder_Comments(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.EncodeNode(tt.node)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -414,8 +929,91 @@ func TestEncoder_Comments(t *testing.T) {
 	}
 }
 
-func TestEncoder_FlowStyle(t *testing.T) {
-	tests := []struct {
+func TestEncoder_SequenceCommentRoundTrip(t *testing.T) {
+	input := "items:\n  - a # first\n  - b # second\n"
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.EncodeNode(node); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	if result := buf.String(); result != input {
+		t.Errorf("expected:\n%s\ngot:\n%s", input, result)
+	}
+}
+
+func TestEncoder_FlowCommentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "flow sequence",
+			input:    "[a, # note\n b]",
+			expected: "[\n  a, # note\n  b\n]\n",
+		},
+		{
+			name:     "flow mapping value",
+			input:    "m: {x: 1, # one\n  # about y\n  y: 2}\n",
+			expected: "m: {\n  x: 1, # one\n  # about y\n  y: 2\n}\n",
+		},
+		{
+			name:     "no comments stays on one line",
+			input:    "[a, b]",
+			expected: "[a, b]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := UnmarshalNode([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			if err := enc.EncodeNode(node); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+			if result := buf.String(); result != tt.expected {
+				t.Fatalf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+
+			reparsed, err := UnmarshalNode(buf.Bytes())
+			if err != nil {
+				t.Fatalf("re-parse error: %v", err)
+			}
+			var again bytes.Buffer
+			enc = NewEncoder(&again)
+			if err := enc.EncodeNode(reparsed); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+			if again.String() != tt.expected {
+				t.Errorf("round trip not stable:\n%s", again.String())
+			}
+		})
+	}
+}
+
+func TestEncoder_FlowStyle(t *testing.T) {
+	tests := []struct {
 		name     string
 		node     ast.Node
 		expected string
@@ -472,6 +1070,9 @@ func TestEncoder_FlowStyle(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.EncodeNode(tt.node)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -484,6 +1085,44 @@ func TestEncoder_FlowStyle(t *testing.T) {
 	}
 }
 
+func TestEncoder_FlowTrailingComma(t *testing.T) {
+	type Config struct {
+		Ports  []int          `yaml:"ports,flow"`
+		Limits map[string]int `yaml:"limits,flow"`
+		Empty  []int          `yaml:"empty,flow"`
+	}
+
+	input := Config{
+		Ports:  []int{80, 443},
+		Limits: map[string]int{"cpu": 2},
+		Empty:  []int{},
+	}
+	expected := "ports: [80, 443,]\nlimits: {cpu: 2,}\nempty: []\n"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetFlowTrailingComma(true)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	result := buf.String()
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	var decoded Config
+	if err := NewDecoder(strings.NewReader(result)).Decode(&decoded); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("round trip: expected %+v, got %+v", input, decoded)
+	}
+}
+
 func TestEncoder_Indentation(t *testing.T) {
 	input := map[string]interface{}{
 		"level1": map[string]interface{}{
@@ -516,6 +1155,52 @@ func TestEncoder_Indentation(t *testing.T) {
 			enc := NewEncoder(&buf)
 			enc.SetIndent(tt.indent)
 			err := enc.Encode(input)
+			if err == nil {
+				err = enc.Flush()
+			}
+			if err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+
+			result := buf.String()
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEncoder_SequenceIndent(t *testing.T) {
+	input := map[string]interface{}{
+		"features": []string{"a", "b", "c"},
+	}
+
+	tests := []struct {
+		name      string
+		seqIndent int
+		expected  string
+	}{
+		{
+			name:      "indented",
+			seqIndent: 2,
+			expected:  "features:\n  - a\n  - b\n  - c\n",
+		},
+		{
+			name:      "flush with key",
+			seqIndent: 0,
+			expected:  "features:\n- a\n- b\n- c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetSequenceIndent(tt.seqIndent)
+			err := enc.Encode(input)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -524,6 +1209,14 @@ func TestEncoder_Indentation(t *testing.T) {
 			if result != tt.expected {
 				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
 			}
+
+			var decoded map[string]interface{}
+			if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			if len(decoded["features"].([]interface{})) != 3 {
+				t.Errorf("expected 3 features after re-parse, got %v", decoded["features"])
+			}
 		})
 	}
 }
@@ -553,6 +1246,9 @@ func TestEncoder_SpecialStrings(t *testing.T) {
 			// Create a scalar that needs quoting
 			scalar := ast.NewScalar(tt.input)
 			err := enc.EncodeNode(scalar)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -565,6 +1261,93 @@ func TestEncoder_SpecialStrings(t *testing.T) {
 	}
 }
 
+func TestEncoder_KeyQuoting(t *testing.T) {
+	input := map[string]int{
+		"a:b":       1,
+		"@handle":   2,
+		" leading":  3,
+		"trailing ": 4,
+		"- x":       5,
+		"*ref":      6,
+		"!tag":      7,
+		"-x":        8,
+		"plain key": 9,
+	}
+	expected := `" leading": 3
+"!tag": 7
+"*ref": 6
+"- x": 5
+-x: 8
+"@handle": 2
+"a:b": 1
+plain key: 9
+"trailing ": 4
+`
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	if result := buf.String(); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	var decoded map[string]int
+	if err := NewDecoder(strings.NewReader(buf.String())).Decode(&decoded); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("round trip: expected %v, got %v", input, decoded)
+	}
+}
+
+func TestEncoder_BoolStyleQuoting(t *testing.T) {
+	input := map[string]string{"a": "on", "b": "No", "c": "true"}
+
+	tests := []struct {
+		name     string
+		style    BoolStyle
+		expected string
+	}{
+		{"default", BoolDefault, "a: \"on\"\nb: \"No\"\nc: \"true\"\n"},
+		{"legacy 1.1", BoolLegacy11, "a: \"on\"\nb: \"No\"\nc: \"true\"\n"},
+		{"core 1.2", BoolCore12, "a: on\nb: No\nc: \"true\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetBoolStyle(tt.style)
+			if err := enc.Encode(input); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+
+			result := buf.String()
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+
+			var decoded map[string]string
+			dec := NewDecoder(strings.NewReader(result))
+			dec.SetBoolStyle(tt.style)
+			if err := dec.Decode(&decoded); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, input) {
+				t.Errorf("round trip: expected %v, got %v", input, decoded)
+			}
+		})
+	}
+}
+
 func TestEncoder_CustomMarshaler(t *testing.T) {
 	type CustomType struct {
 		value string
@@ -603,6 +1386,9 @@ func TestEncoder_CustomMarshaler(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
 			if err != nil {
 				t.Fatalf("encode error: %v", err)
 			}
@@ -615,6 +1401,239 @@ func TestEncoder_CustomMarshaler(t *testing.T) {
 	}
 }
 
+type upperString string
+
+func (s upperString) MarshalYAML() (interface{}, error) {
+	return strings.ToUpper(string(s)), nil
+}
+
+type point struct {
+	X, Y int
+}
+
+func (p *point) MarshalYAML() (interface{}, error) {
+	return []int{p.X, p.Y}, nil
+}
+
+func TestEncoder_MapValueMarshaler(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{
+			name: "value receiver",
+			input: map[string]interface{}{
+				"name": upperString("app"),
+			},
+			expected: "name: APP\n",
+		},
+		{
+			name: "pointer receiver",
+			input: map[string]interface{}{
+				"origin": &point{X: 1, Y: 2},
+			},
+			expected: "origin:\n  - 1\n  - 2\n",
+		},
+		{
+			name: "typed map",
+			input: map[string]upperString{
+				"a": "x",
+				"b": "y",
+			},
+			expected: "a: X\nb: Y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
+			if err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+
+			result := buf.String()
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+type level int
+
+func (l level) String() string {
+	return [...]string{"low", "high"}[l]
+}
+
+func TestEncoder_AutoAnchor(t *testing.T) {
+	type Database struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+	type Config struct {
+		Primary  Database `yaml:"primary"`
+		Replica  Database `yaml:"replica"`
+		Tags     []string `yaml:"tags"`
+		Labels   []string `yaml:"labels"`
+		Fallback Database `yaml:"fallback"`
+	}
+
+	db := Database{Host: "db", Port: 5432}
+	input := Config{
+		Primary:  db,
+		Replica:  db,
+		Tags:     []string{"a", "b"},
+		Labels:   []string{"a", "b"},
+		Fallback: Database{Host: "backup", Port: 5432},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetAutoAnchor(true)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	expected := `primary: &auto1
+  host: db
+  port: 5432
+replica: *auto1
+tags: &auto2
+  - a
+  - b
+labels: *auto2
+fallback:
+  host: backup
+  port: 5432
+`
+	if result := buf.String(); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	var decoded Config
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("round trip: expected %+v, got %+v", input, decoded)
+	}
+}
+
+func TestEncoder_AutoAnchorDistinctTypes(t *testing.T) {
+	input := MapSlice{
+		{Key: "a", Value: []interface{}{"1", "true"}},
+		{Key: "b", Value: []interface{}{1, true}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetAutoAnchor(true)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	if strings.Contains(buf.String(), "*auto") {
+		t.Fatalf("expected no aliases, got:\n%s", buf.String())
+	}
+
+	var decoded map[string]interface{}
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"a": []interface{}{"1", "true"},
+		"b": []interface{}{int64(1), true},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("round trip: expected %#v, got %#v", expected, decoded)
+	}
+}
+
+func TestEncoder_NumericTypes(t *testing.T) {
+	type celsius float64
+
+	tests := []struct {
+		name        string
+		input       interface{}
+		useStringer bool
+		expected    string
+	}{
+		{
+			name: "json.Number integer",
+			input: struct {
+				Count json.Number `yaml:"count"`
+			}{Count: json.Number("42")},
+			expected: "count: 42\n",
+		},
+		{
+			name: "json.Number float",
+			input: map[string]json.Number{
+				"ratio": "1.5e3",
+			},
+			expected: "ratio: 1.5e3\n",
+		},
+		{
+			name:     "uintptr",
+			input:    map[string]uintptr{"addr": 4096},
+			expected: "addr: 4096\n",
+		},
+		{
+			name:     "named float",
+			input:    map[string]celsius{"temp": 21.5},
+			expected: "temp: 21.5\n",
+		},
+		{
+			name:     "stringer disabled",
+			input:    map[string]level{"level": 1},
+			expected: "level: 1\n",
+		},
+		{
+			name:        "stringer enabled",
+			input:       map[string]level{"level": 1},
+			useStringer: true,
+			expected:    "level: high\n",
+		},
+		{
+			name: "json.Number with stringer",
+			input: map[string]json.Number{
+				"count": "7",
+			},
+			useStringer: true,
+			expected:    "count: 7\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetUseStringer(tt.useStringer)
+			if err := enc.Encode(tt.input); err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+
+			result := buf.String()
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestEncoder_MultiDocument(t *testing.T) {
 	combined := &ast.Document{
 		Content: []ast.Node{
@@ -626,6 +1645,9 @@ func TestEncoder_MultiDocument(t *testing.T) {
 	var buf bytes.Buffer
 	enc := NewEncoder(&buf)
 	err := enc.EncodeNode(combined)
+	if err == nil {
+		err = enc.Flush()
+	}
 	if err != nil {
 		t.Fatalf("encode error: %v", err)
 	}
@@ -637,6 +1659,153 @@ func TestEncoder_MultiDocument(t *testing.T) {
 	}
 }
 
+func TestEncoder_DocumentStream(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	docs := []interface{}{
+		map[string]int{"a": 1},
+		[]string{"x", "y"},
+		"third",
+	}
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	expected := "a: 1\n\n---\n- x\n- y\n\n---\nthird\n"
+	if result := buf.String(); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	node, err := UnmarshalNode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if n := len(node.(*ast.Document).Content); n != len(docs) {
+		t.Errorf("expected %d documents, got %d", len(docs), n)
+	}
+}
+
+func TestEncoder_ExplicitDocumentStart(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetExplicitDocumentStart(true)
+	if err := enc.Encode(map[string]int{"a": 1, "b": 2}); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	expected := "---\na: 1\nb: 2\n"
+	if result := buf.String(); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	if err := enc.Encode("second"); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	expected += "\n---\nsecond\n"
+	if result := buf.String(); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	var decoded map[string]int
+	if err := Unmarshal([]byte("---\na: 1\nb: 2\n"), &decoded); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if decoded["a"] != 1 || decoded["b"] != 2 {
+		t.Errorf("unexpected round trip result: %v", decoded)
+	}
+}
+
+func TestEncoder_ExplicitDocumentEnd(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetExplicitDocumentEnd(true)
+	for _, doc := range []interface{}{map[string]int{"a": 1}, "second"} {
+		if err := enc.Encode(doc); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+	}
+
+	expected := "a: 1\n...\n\n---\nsecond\n...\n"
+	if result := buf.String(); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	node, err := UnmarshalNode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if n := len(node.(*ast.Document).Content); n != 2 {
+		t.Errorf("expected 2 documents, got %d", n)
+	}
+
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	enc.SetExplicitDocumentStart(true)
+	enc.SetExplicitDocumentEnd(true)
+	if err := enc.Encode([]int{1}); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	if expected := "---\n- 1\n...\n"; buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestEncoder_BuffersUntilFlush(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, doc := range []interface{}{map[string]int{"a": 1}, "second"} {
+		if err := enc.Encode(doc); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected output to stay buffered until Flush, got:\n%s", buf.String())
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	if expected := "a: 1\n\n---\nsecond\n"; buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEncoder_FlushError(t *testing.T) {
+	enc := NewEncoder(failingWriter{})
+	if err := enc.Encode(map[string]int{"a": 1}); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := enc.Flush(); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected Flush to report the write error, got %v", err)
+	}
+}
+
 func TestEncoder_ErrorCases(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -660,6 +1829,9 @@ func TestEncoder_ErrorCases(t *testing.T) {
 			var buf bytes.Buffer
 			enc := NewEncoder(&buf)
 			err := enc.Encode(tt.input)
+			if err == nil {
+				err = enc.Flush()
+			}
 
 			if tt.wantError && err == nil {
 				t.Error("expected error but got none")
@@ -670,6 +1842,40 @@ func TestEncoder_ErrorCases(t *testing.T) {
 	}
 }
 
+func TestEncoder_ErrorPaths(t *testing.T) {
+	type Settings struct {
+		Name string   `yaml:"name"`
+		Ch   chan int `yaml:"ch"`
+	}
+	type Config struct {
+		Settings Settings `yaml:"settings"`
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		want  string
+	}{
+		{"root", make(chan int), "unsupported type chan int"},
+		{"struct field", Config{}, "unsupported type chan int at .settings.ch"},
+		{"sequence item", map[string]interface{}{"items": []interface{}{1, func() {}}}, "unsupported type func() at .items[1]"},
+		{"map value", map[string]interface{}{"n": map[string]complex128{"c": 1}}, "unsupported type complex128 at .n.c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := NewEncoder(&buf).Encode(tt.input)
+			if err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("expected error %q, got %q", tt.want, err)
+			}
+		})
+	}
+}
+
 func BenchmarkEncoder_SimpleStruct(b *testing.B) {
 	type Simple struct {
 		Name  string `yaml:"name"`
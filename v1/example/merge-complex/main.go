@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
 
 	yaml "golang-yaml/v1"
 )
@@ -91,12 +90,6 @@ environment: production
 	fmt.Println("\nMerged Result (Deep Merge with Array Append):")
 	fmt.Println(string(merged))
 
-	// Save the merged result to file
-	err = os.WriteFile("yaml-merged-result.yaml", merged, 0644)
-	if err != nil {
-		log.Fatalf("Failed to save merged result: %v", err)
-	}
-	fmt.Println("\n✅ Merged result saved to: yaml-merged-result.yaml")
 
 	mergeOptsReplace := yaml.MergeOptions{
 		Mode:               yaml.MergeDeep,
@@ -112,11 +105,5 @@ environment: production
 	fmt.Println("\nMerged Result (Deep Merge with Array Replace):")
 	fmt.Println(string(mergedReplace))
 
-	// Save the array-replaced merged result to file
-	err = os.WriteFile("yaml-merged-result-replace.yaml", mergedReplace, 0644)
-	if err != nil {
-		log.Fatalf("Failed to save merged result: %v", err)
-	}
-	fmt.Println("\n✅ Array-replace result saved to: yaml-merged-result-replace.yaml")
 	fmt.Println()
 }
\ No newline at end of file
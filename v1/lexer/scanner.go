@@ -41,12 +41,47 @@ func (s *Scanner) Scan() (Token, error) {
 	return s.scanNext()
 }
 
+// Peek returns the next token without consuming it.
+func (s *Scanner) Peek() (Token, error) {
+	if s.tokenIndex < len(s.tokens) {
+		return s.tokens[s.tokenIndex], nil
+	}
+
+	token, err := s.scanNext()
+	if err != nil {
+		return token, err
+	}
+	s.tokens = append(s.tokens[:0], token)
+	s.tokenIndex = 0
+	return token, nil
+}
+
+// Tokens scans the rest of the input and returns every token, including
+// comments and newlines, ending with the EOF token.
+func (s *Scanner) Tokens() ([]Token, error) {
+	var tokens []Token
+	for {
+		token, err := s.Scan()
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+		if token.Type == TokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
 func (s *Scanner) PushBack(token Token) {
 	s.tokens = append([]Token{token}, s.tokens[s.tokenIndex:]...)
 	s.tokenIndex = 0
 }
 
 func (s *Scanner) scanNext() (Token, error) {
+	if s.column == 1 && s.inFlow == 0 && s.hasTabIndent() {
+		return Token{}, fmt.Errorf("tab character used for indentation at line %d", s.line)
+	}
+
 	s.skipWhitespace()
 
 	if s.isEOF() {
@@ -63,6 +98,10 @@ func (s *Scanner) scanNext() (Token, error) {
 		return s.scanNewline()
 	}
 
+	if s.column == 1 && ch == '%' {
+		return s.scanDirective()
+	}
+
 	if s.column == 1 && ch == '-' && s.peekAhead(1) == '-' && s.peekAhead(2) == '-' {
 		return s.scanDocumentStart()
 	}
@@ -71,7 +110,7 @@ func (s *Scanner) scanNext() (Token, error) {
 		return s.scanDocumentEnd()
 	}
 
-	if ch == '-' && s.peekAhead(1) == ' ' {
+	if ch == '-' && (s.peekAhead(1) == ' ' || s.peekAhead(1) == '\n' || s.isEOFAt(1)) {
 		return s.scanSequenceItem()
 	}
 
@@ -95,7 +134,7 @@ func (s *Scanner) scanNext() (Token, error) {
 		return s.scanFlowEntry()
 	}
 
-	if ch == ':' && (s.peekAhead(1) == ' ' || s.peekAhead(1) == '\n' || s.isEOFAt(1)) {
+	if ch == ':' && (s.peekAhead(1) == ' ' || s.peekAhead(1) == '\n' || s.isEOFAt(1) || s.isAdjacentFlowKey()) {
 		return s.scanKey()
 	}
 
@@ -134,15 +173,14 @@ func (s *Scanner) scanComment() (Token, error) {
 	startPos := s.makePosition()
 	s.advance()
 
-	var comment bytes.Buffer
+	start := s.position
 	for !s.isEOF() && s.peek() != '\n' {
-		comment.WriteByte(s.peek())
 		s.advance()
 	}
 
 	return Token{
 		Type:   TokenComment,
-		Value:  strings.TrimSpace(comment.String()),
+		Value:  strings.TrimSpace(string(s.buffer[start:s.position])),
 		Line:   startPos.line,
 		Column: startPos.column,
 		Offset: startPos.offset,
@@ -165,6 +203,20 @@ func (s *Scanner) scanDocumentStart() (Token, error) {
 	return token, nil
 }
 
+// scanDirective scans a %YAML or %TAG line. The token value is the directive
+// without its leading '%', e.g. "YAML 1.1".
+func (s *Scanner) scanDirective() (Token, error) {
+	token := s.makeToken(TokenDirective, "")
+	s.advance()
+
+	start := s.position
+	for !s.isEOF() && s.peek() != '\n' && !(s.peek() == '#' && s.position > start && s.buffer[s.position-1] == ' ') {
+		s.advance()
+	}
+	token.Value = strings.TrimSpace(string(s.buffer[start:s.position]))
+	return token, nil
+}
+
 func (s *Scanner) scanDocumentEnd() (Token, error) {
 	token := s.makeToken(TokenDocumentEnd, "...")
 	s.advance()
@@ -176,7 +228,9 @@ func (s *Scanner) scanDocumentEnd() (Token, error) {
 func (s *Scanner) scanSequenceItem() (Token, error) {
 	token := s.makeToken(TokenSequenceItem, "-")
 	s.advance()
-	s.advance()
+	if s.peek() == ' ' {
+		s.advance()
+	}
 	return token, nil
 }
 
@@ -246,7 +300,7 @@ func (s *Scanner) scanLiteralBlock() (Token, error) {
 			break
 		}
 
-		s.skipIndent(indent)
+		s.skipIndent(min(indent, baseIndent))
 
 		for !s.isEOF() && s.peek() != '\n' {
 			content.WriteByte(s.peek())
@@ -295,7 +349,7 @@ func (s *Scanner) scanFoldedBlock() (Token, error) {
 			break
 		}
 
-		s.skipIndent(indent)
+		s.skipIndent(min(indent, baseIndent))
 
 		lineEmpty := s.peek() == '\n'
 
@@ -356,6 +410,7 @@ func (s *Scanner) scanSingleQuotedString() (Token, error) {
 	s.advance()
 
 	var str bytes.Buffer
+	closed := false
 	for !s.isEOF() {
 		ch := s.peek()
 		if ch == '\'' {
@@ -365,6 +420,7 @@ func (s *Scanner) scanSingleQuotedString() (Token, error) {
 				s.advance()
 			} else {
 				s.advance()
+				closed = true
 				break
 			}
 		} else {
@@ -377,9 +433,14 @@ func (s *Scanner) scanSingleQuotedString() (Token, error) {
 		}
 	}
 
+	if !closed {
+		return Token{}, fmt.Errorf("unterminated single-quoted string at line %d, column %d", startPos.line, startPos.column)
+	}
+
 	return Token{
 		Type:   TokenString,
 		Value:  str.String(),
+		Style:  SingleQuotedScalar,
 		Line:   startPos.line,
 		Column: startPos.column,
 		Offset: startPos.offset,
@@ -391,10 +452,12 @@ func (s *Scanner) scanDoubleQuotedString() (Token, error) {
 	s.advance()
 
 	var str bytes.Buffer
+	closed := false
 	for !s.isEOF() {
 		ch := s.peek()
 		if ch == '"' {
 			s.advance()
+			closed = true
 			break
 		} else if ch == '\\' {
 			s.advance()
@@ -438,9 +501,14 @@ func (s *Scanner) scanDoubleQuotedString() (Token, error) {
 		}
 	}
 
+	if !closed {
+		return Token{}, fmt.Errorf("unterminated double-quoted string at line %d, column %d", startPos.line, startPos.column)
+	}
+
 	return Token{
 		Type:   TokenString,
 		Value:  str.String(),
+		Style:  DoubleQuotedScalar,
 		Line:   startPos.line,
 		Column: startPos.column,
 		Offset: startPos.offset,
@@ -451,15 +519,14 @@ func (s *Scanner) scanAnchor() (Token, error) {
 	startPos := s.makePosition()
 	s.advance()
 
-	var anchor bytes.Buffer
+	start := s.position
 	for !s.isEOF() && s.isAnchorChar(s.peek()) {
-		anchor.WriteByte(s.peek())
 		s.advance()
 	}
 
 	return Token{
 		Type:   TokenAnchor,
-		Value:  anchor.String(),
+		Value:  string(s.buffer[start:s.position]),
 		Line:   startPos.line,
 		Column: startPos.column,
 		Offset: startPos.offset,
@@ -470,15 +537,14 @@ func (s *Scanner) scanAlias() (Token, error) {
 	startPos := s.makePosition()
 	s.advance()
 
-	var alias bytes.Buffer
+	start := s.position
 	for !s.isEOF() && s.isAnchorChar(s.peek()) {
-		alias.WriteByte(s.peek())
 		s.advance()
 	}
 
 	return Token{
 		Type:   TokenAlias,
-		Value:  alias.String(),
+		Value:  string(s.buffer[start:s.position]),
 		Line:   startPos.line,
 		Column: startPos.column,
 		Offset: startPos.offset,
@@ -509,13 +575,63 @@ func (s *Scanner) scanTag() (Token, error) {
 	}, nil
 }
 
+// isAdjacentFlowKey reports whether a ':' inside a flow collection is a
+// value indicator even though no space follows it. YAML allows this after a
+// quoted scalar or flow collection, as in {"a":1}, and before another flow
+// indicator, as in {a:,b:}.
+func (s *Scanner) isAdjacentFlowKey() bool {
+	if s.inFlow == 0 {
+		return false
+	}
+	if s.isFlowIndicatorAt(1) {
+		return true
+	}
+	if s.position == 0 {
+		return false
+	}
+	switch s.buffer[s.position-1] {
+	case '"', '\'', ']', '}':
+		return true
+	}
+	return false
+}
+
+func (s *Scanner) isFlowIndicatorAt(offset int) bool {
+	if s.inFlow == 0 {
+		return false
+	}
+	switch s.peekAhead(offset) {
+	case ',', '}', ']':
+		return true
+	}
+	return false
+}
+
 func (s *Scanner) scanScalar() (Token, error) {
 	startPos := s.makePosition()
+	minIndent := s.continuationIndent()
+
+	value := s.scanPlainLine()
+	if s.inFlow == 0 {
+		value = s.foldPlainLines(value, minIndent)
+	}
+	tokenType := s.detectScalarType(value)
+
+	return Token{
+		Type:   tokenType,
+		Value:  value,
+		Line:   startPos.line,
+		Column: startPos.column,
+		Offset: startPos.offset,
+	}, nil
+}
 
-	var scalar bytes.Buffer
+// scanPlainLine scans the part of a plain scalar on the current line.
+func (s *Scanner) scanPlainLine() string {
+	start := s.position
 	for !s.isEOF() {
 		ch := s.peek()
-		if ch == ':' && (s.peekAhead(1) == ' ' || s.peekAhead(1) == '\n' || s.isEOFAt(1)) {
+		if ch == ':' && (s.peekAhead(1) == ' ' || s.peekAhead(1) == '\n' || s.isEOFAt(1) || s.isFlowIndicatorAt(1)) {
 			break
 		}
 		if ch == '\n' || ch == '#' {
@@ -524,20 +640,128 @@ func (s *Scanner) scanScalar() (Token, error) {
 		if s.inFlow > 0 && (ch == ',' || ch == '}' || ch == ']') {
 			break
 		}
-		scalar.WriteByte(ch)
 		s.advance()
 	}
+	return strings.TrimSpace(string(s.buffer[start:s.position]))
+}
 
-	value := strings.TrimSpace(scalar.String())
-	tokenType := s.detectScalarType(value)
+// continuationIndent returns the indentation a line needs to continue a
+// plain scalar starting at the current position. A scalar that begins its
+// line may continue at the same indentation; one that follows a key or a
+// sequence indicator must continue further in than the line's content.
+func (s *Scanner) continuationIndent() int {
+	lineStart := s.position
+	for lineStart > 0 && s.buffer[lineStart-1] != '\n' {
+		lineStart--
+	}
 
-	return Token{
-		Type:   tokenType,
-		Value:  value,
-		Line:   startPos.line,
-		Column: startPos.column,
-		Offset: startPos.offset,
-	}, nil
+	pos := lineStart
+	for pos < s.position && s.buffer[pos] == ' ' {
+		pos++
+	}
+	indent := pos - lineStart
+	if pos == s.position {
+		return indent
+	}
+
+	for pos+1 < s.position && s.buffer[pos] == '-' && s.buffer[pos+1] == ' ' {
+		pos += 2
+		for pos < s.position && s.buffer[pos] == ' ' {
+			pos++
+		}
+	}
+	if pos == s.position {
+		return indent + 1
+	}
+	return pos - lineStart + 1
+}
+
+// foldPlainLines appends the continuation lines of a multi-line plain
+// scalar to value. Each line break folds to a space, and n empty lines
+// between two lines fold to n newlines. Continuation stops at a line that
+// is indented less than minIndent or that starts a comment, sequence
+// item, document marker or mapping key.
+func (s *Scanner) foldPlainLines(value string, minIndent int) string {
+	for s.peek() == '\n' {
+		offset, breaks := 0, 0
+		for s.peekAhead(offset) == '\n' {
+			offset++
+			breaks++
+			for s.peekAhead(offset) == ' ' {
+				offset++
+			}
+			if s.peekAhead(offset) == '\r' && s.peekAhead(offset+1) == '\n' {
+				offset++
+			}
+		}
+		if !s.isPlainContinuation(offset, minIndent) {
+			break
+		}
+
+		for i := 0; i < offset; i++ {
+			if s.peek() == '\n' {
+				s.advance()
+				s.line++
+				s.column = 1
+				continue
+			}
+			s.advance()
+		}
+
+		if breaks == 1 {
+			value += " "
+		} else {
+			value += strings.Repeat("\n", breaks-1)
+		}
+		value += s.scanPlainLine()
+	}
+	return value
+}
+
+// isPlainContinuation reports whether the line whose content starts at
+// offset continues a plain scalar.
+func (s *Scanner) isPlainContinuation(offset, minIndent int) bool {
+	if s.isEOFAt(offset) {
+		return false
+	}
+
+	indent := 0
+	for indent < offset && s.peekAhead(offset-indent-1) == ' ' {
+		indent++
+	}
+	if indent < minIndent {
+		return false
+	}
+
+	switch ch := s.peekAhead(offset); ch {
+	case '#', '\t', '\r':
+		return false
+	case '-', '?':
+		next := s.peekAhead(offset + 1)
+		if next == ' ' || next == '\n' || s.isEOFAt(offset+1) {
+			return false
+		}
+		if indent == 0 && ch == '-' && next == '-' && s.peekAhead(offset+2) == '-' {
+			return false
+		}
+	case '.':
+		if indent == 0 && s.peekAhead(offset+1) == '.' && s.peekAhead(offset+2) == '.' {
+			return false
+		}
+	}
+
+	for i := offset; !s.isEOFAt(i); i++ {
+		switch s.peekAhead(i) {
+		case '\n', '#':
+			return true
+		case ':':
+			next := s.peekAhead(i + 1)
+			if next == ' ' || next == '\n' || next == '\r' || s.isEOFAt(i+1) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 func (s *Scanner) detectScalarType(value string) TokenType {
@@ -558,30 +782,118 @@ func (s *Scanner) detectScalarType(value string) TokenType {
 }
 
 func (s *Scanner) isNumber(value string) bool {
-	if len(value) == 0 {
-		return false
+	return IsInt(value) || IsFloat(value)
+}
+
+// SplitInt breaks an integer literal into its sign and digits, with
+// underscores removed, and the base implied by its 0x, 0o or 0b prefix.
+// Underscores may only separate digits or directly follow a base prefix,
+// so 1_000 and 0x_FF are accepted while 1__0 and _5 are not.
+func SplitInt(value string) (digits string, base int, ok bool) {
+	sign := ""
+	if value != "" && (value[0] == '+' || value[0] == '-') {
+		sign, value = value[:1], value[1:]
 	}
 
-	if value == ".inf" || value == "-.inf" || value == "+.inf" || value == ".nan" {
-		return true
+	base = 10
+	isDigit := isDecimalDigit
+	switch {
+	case strings.HasPrefix(value, "0x"):
+		base, isDigit = 16, isHexDigit
+	case strings.HasPrefix(value, "0o"):
+		base, isDigit = 8, isOctalDigit
+	case strings.HasPrefix(value, "0b"):
+		base, isDigit = 2, isBinaryDigit
+	}
+	if base != 10 {
+		value = strings.TrimPrefix(value[2:], "_")
 	}
 
-	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0o") || strings.HasPrefix(value, "0b") {
+	if !isDigitSequence(value, isDigit) {
+		return "", 0, false
+	}
+	return sign + strings.ReplaceAll(value, "_", ""), base, true
+}
+
+// IsInt reports whether value is an integer literal accepted by SplitInt.
+func IsInt(value string) bool {
+	_, _, ok := SplitInt(value)
+	return ok
+}
+
+// IsFloat reports whether value is a floating point literal: a decimal
+// mantissa with a fraction or exponent, or one of the special values
+// .inf, +.inf, -.inf and .nan.
+func IsFloat(value string) bool {
+	switch value {
+	case ".inf", "+.inf", "-.inf", ".nan":
 		return true
 	}
 
-	for i, ch := range value {
-		if !unicode.IsDigit(ch) && ch != '.' && ch != '-' && ch != '+' && ch != 'e' && ch != 'E' && ch != '_' {
-			return false
+	if value != "" && (value[0] == '+' || value[0] == '-') {
+		value = value[1:]
+	}
+
+	mantissa, exponent, hasExponent := strings.Cut(value, "e")
+	if !hasExponent {
+		mantissa, exponent, hasExponent = strings.Cut(value, "E")
+	}
+	if hasExponent {
+		if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+			exponent = exponent[1:]
 		}
-		if (ch == '-' || ch == '+') && i != 0 && value[i-1] != 'e' && value[i-1] != 'E' {
+		if !isDigitSequence(exponent, isDecimalDigit) {
 			return false
 		}
 	}
 
+	whole, fraction, hasPoint := strings.Cut(mantissa, ".")
+	if !hasPoint && !hasExponent {
+		return false
+	}
+	if whole == "" && fraction == "" {
+		return false
+	}
+	if whole != "" && !isDigitSequence(whole, isDecimalDigit) {
+		return false
+	}
+	return fraction == "" || isDigitSequence(fraction, isDecimalDigit)
+}
+
+func isDigitSequence(value string, isDigit func(byte) bool) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] == '_' {
+			if i == 0 || i == len(value)-1 || value[i-1] == '_' {
+				return false
+			}
+			continue
+		}
+		if !isDigit(value[i]) {
+			return false
+		}
+	}
 	return true
 }
 
+func isDecimalDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isHexDigit(ch byte) bool {
+	return isDecimalDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func isOctalDigit(ch byte) bool {
+	return ch >= '0' && ch <= '7'
+}
+
+func isBinaryDigit(ch byte) bool {
+	return ch == '0' || ch == '1'
+}
+
 func (s *Scanner) isAnchorChar(ch byte) bool {
 	return unicode.IsLetter(rune(ch)) || unicode.IsDigit(rune(ch)) || ch == '_' || ch == '-'
 }
@@ -601,13 +913,39 @@ func (s *Scanner) skipToEndOfLine() {
 func (s *Scanner) countIndent() int {
 	indent := 0
 	pos := s.position
-	for pos < len(s.buffer) && s.buffer[pos] == ' ' {
+	for {
+		if pos >= len(s.buffer) && !s.fillBuffer() {
+			break
+		}
+		if s.buffer[pos] != ' ' {
+			break
+		}
 		indent++
 		pos++
 	}
 	return indent
 }
 
+// hasTabIndent reports whether the leading whitespace of the current line
+// contains a tab. Lines holding only whitespace or a comment may use tabs.
+func (s *Scanner) hasTabIndent() bool {
+	tab := false
+	for pos := s.position; ; pos++ {
+		if pos >= len(s.buffer) && !s.fillBuffer() {
+			return false
+		}
+		switch s.buffer[pos] {
+		case ' ':
+		case '\t':
+			tab = true
+		case '\n', '\r', '#':
+			return false
+		default:
+			return tab
+		}
+	}
+}
+
 func (s *Scanner) skipIndent(count int) {
 	for i := 0; i < count && !s.isEOF() && s.peek() == ' '; i++ {
 		s.advance()
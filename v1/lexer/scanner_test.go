@@ -52,6 +52,11 @@ func TestScanner_BasicTokens(t *testing.T) {
 			input:    "---\ndata\n...",
 			expected: []TokenType{TokenDocumentStart, TokenNewLine, TokenString, TokenNewLine, TokenDocumentEnd, TokenEOF},
 		},
+		{
+			name:     "version directive",
+			input:    "%YAML 1.2\n---\ndata",
+			expected: []TokenType{TokenDirective, TokenNewLine, TokenDocumentStart, TokenNewLine, TokenString, TokenEOF},
+		},
 		{
 			name:     "sequence items",
 			input:    "- item1\n- item2",
@@ -306,6 +311,49 @@ func TestScanner_SpecialValues(t *testing.T) {
 	}
 }
 
+func TestScanner_NumberGrammar(t *testing.T) {
+	tests := []struct {
+		input string
+		ttype TokenType
+	}{
+		{"1_000_000", TokenNumber},
+		{"+42", TokenNumber},
+		{"-42", TokenNumber},
+		{"0x_FF", TokenNumber},
+		{"0o_17", TokenNumber},
+		{"0b_1010", TokenNumber},
+		{"+0x1F", TokenNumber},
+		{"1_000.5", TokenNumber},
+		{"1e5", TokenNumber},
+		{"1__0", TokenString},
+		{"_5", TokenString},
+		{"5_", TokenString},
+		{"0x", TokenString},
+		{"0x__FF", TokenString},
+		{"0o8", TokenString},
+		{"1.2.3", TokenString},
+		{"2.0.0", TokenString},
+		{"10.0.0.1", TokenString},
+		{"1..2", TokenString},
+		{"1.2e3.4", TokenString},
+		{"+", TokenString},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			scanner := NewScanner(strings.NewReader(tt.input))
+			token, err := scanner.Scan()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if token.Type != tt.ttype {
+				t.Errorf("expected type %v, got %v", tt.ttype, token.Type)
+			}
+		})
+	}
+}
+
 func TestScanner_ErrorCases(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -322,6 +370,26 @@ func TestScanner_ErrorCases(t *testing.T) {
 			input:     `"unclosed`,
 			wantError: true,
 		},
+		{
+			name:      "tab indentation",
+			input:     "parent:\n\tchild: value",
+			wantError: true,
+		},
+		{
+			name:      "tab after spaces",
+			input:     "parent:\n  \tchild: value",
+			wantError: true,
+		},
+		{
+			name:      "tab on blank and comment lines",
+			input:     "a: 1\n\t\n\t# note\nb: 2",
+			wantError: false,
+		},
+		{
+			name:      "tab inside flow collection",
+			input:     "a: [1,\n\t2]",
+			wantError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -346,6 +414,14 @@ func TestScanner_ErrorCases(t *testing.T) {
 	}
 }
 
+func TestScanner_TabIndentation(t *testing.T) {
+	scanner := NewScanner(strings.NewReader("server:\n  host: a\n\tport: 1"))
+	_, err := scanner.Tokens()
+	if err == nil || err.Error() != "tab character used for indentation at line 3" {
+		t.Errorf("expected tab indentation error, got %v", err)
+	}
+}
+
 func TestScanner_Position(t *testing.T) {
 	input := `key: value
 nested:
@@ -408,6 +484,40 @@ func TestScanner_PushBack(t *testing.T) {
 	}
 }
 
+func TestScanner_Peek(t *testing.T) {
+	input := `name: app
+server:
+  port: 8080
+features: [a, b]`
+
+	var expected []Token
+	scanner := NewScanner(strings.NewReader(input))
+	for {
+		token, err := scanner.Scan()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected = append(expected, token)
+		if token.Type == TokenEOF {
+			break
+		}
+	}
+
+	scanner = NewScanner(strings.NewReader(input))
+	for i, want := range expected {
+		peeked, err := scanner.Peek()
+		if err != nil {
+			t.Fatalf("unexpected peek error: %v", err)
+		}
+		again, _ := scanner.Peek()
+		token, _ := scanner.Scan()
+
+		if peeked != want || again != want || token != want {
+			t.Errorf("token %d: expected %v, peeked %v then %v, scanned %v", i, want, peeked, again, token)
+		}
+	}
+}
+
 func TestScanner_BlockScalars(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -595,6 +705,84 @@ tags:
 	}
 }
 
+func TestScanner_Tokens(t *testing.T) {
+	input := `---
+# Configuration file
+name: MyApp # Application name
+server:
+  port: 8080
+features:
+  - &metrics metrics
+  - *metrics
+tags: !custom_tag value
+...`
+
+	expected := []struct {
+		typ    TokenType
+		value  string
+		line   int
+		column int
+	}{
+		{TokenDocumentStart, "---", 1, 1},
+		{TokenNewLine, "\n", 1, 4},
+		{TokenComment, "Configuration file", 2, 1},
+		{TokenNewLine, "\n", 2, 21},
+		{TokenString, "name", 3, 1},
+		{TokenKey, ":", 3, 5},
+		{TokenString, "MyApp", 3, 7},
+		{TokenComment, "Application name", 3, 13},
+		{TokenNewLine, "\n", 3, 31},
+		{TokenString, "server", 4, 1},
+		{TokenKey, ":", 4, 7},
+		{TokenNewLine, "\n", 4, 8},
+		{TokenString, "port", 5, 3},
+		{TokenKey, ":", 5, 7},
+		{TokenNumber, "8080", 5, 9},
+		{TokenNewLine, "\n", 5, 13},
+		{TokenString, "features", 6, 1},
+		{TokenKey, ":", 6, 9},
+		{TokenNewLine, "\n", 6, 10},
+		{TokenSequenceItem, "-", 7, 3},
+		{TokenAnchor, "metrics", 7, 5},
+		{TokenString, "metrics", 7, 14},
+		{TokenNewLine, "\n", 7, 21},
+		{TokenSequenceItem, "-", 8, 3},
+		{TokenAlias, "metrics", 8, 5},
+		{TokenNewLine, "\n", 8, 13},
+		{TokenString, "tags", 9, 1},
+		{TokenKey, ":", 9, 5},
+		{TokenTag, "custom_tag", 9, 7},
+		{TokenString, "value", 9, 19},
+		{TokenNewLine, "\n", 9, 24},
+		{TokenDocumentEnd, "...", 10, 1},
+		{TokenEOF, "", 10, 4},
+	}
+
+	tokens, err := NewScanner(strings.NewReader(input)).Tokens()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+
+	for i, want := range expected {
+		got := tokens[i]
+		if got.Type != want.typ || got.Value != want.value || got.Line != want.line || got.Column != want.column {
+			t.Errorf("token %d: expected %s %q at (%d,%d), got %s %q at (%d,%d)",
+				i, want.typ, want.value, want.line, want.column, got.Type, got.Value, got.Line, got.Column)
+		}
+	}
+
+	tokens, err = NewScanner(strings.NewReader("a: 'oops")).Tokens()
+	if err == nil {
+		t.Fatal("expected error for unterminated string")
+	}
+	if len(tokens) != 2 {
+		t.Errorf("expected the 2 tokens before the error, got %d", len(tokens))
+	}
+}
+
 func BenchmarkScanner_SimpleDocument(b *testing.B) {
 	input := `key1: value1
 key2: value2
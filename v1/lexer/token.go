@@ -31,12 +31,23 @@ const (
 	TokenFlowMappingStart
 	TokenFlowMappingEnd
 	TokenFlowEntry
+	TokenDirective
 	TokenError
 )
 
+// ScalarStyle records how a string token was written in the source.
+type ScalarStyle int
+
+const (
+	PlainScalar ScalarStyle = iota
+	SingleQuotedScalar
+	DoubleQuotedScalar
+)
+
 type Token struct {
 	Type   TokenType
 	Value  string
+	Style  ScalarStyle
 	Line   int
 	Column int
 	Offset int
@@ -70,6 +81,7 @@ func (t TokenType) String() string {
 		TokenFlowMappingStart:  "FlowMappingStart",
 		TokenFlowMappingEnd:    "FlowMappingEnd",
 		TokenFlowEntry:         "FlowEntry",
+		TokenDirective:         "Directive",
 		TokenError:             "Error",
 	}
 
@@ -0,0 +1,115 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"golang-yaml/v1/lexer"
+)
+
+// LintKind identifies the problem a LintWarning reports.
+type LintKind int
+
+const (
+	// LintUnusedAnchor is an anchor that no alias refers to.
+	LintUnusedAnchor LintKind = iota
+	// LintDuplicateAnchor is an anchor name defined again in the same
+	// document, which hides the earlier definition from later aliases.
+	LintDuplicateAnchor
+	// LintUndefinedAlias is an alias to an anchor not defined before it.
+	LintUndefinedAlias
+	// LintSyntaxError is input that could not be scanned; Lint stops there.
+	LintSyntaxError
+)
+
+// LintWarning is a problem found by Lint. Line and Column locate the anchor
+// or alias it concerns, and are zero for syntax errors, whose message
+// already includes the position.
+type LintWarning struct {
+	Kind    LintKind
+	Line    int
+	Column  int
+	Message string
+}
+
+func (w LintWarning) String() string {
+	if w.Line == 0 {
+		return w.Message
+	}
+	return fmt.Sprintf("%s at line %d, column %d", w.Message, w.Line, w.Column)
+}
+
+// Lint checks the anchors and aliases of every document in data and
+// returns the problems found, ordered by position. Anchors are scoped to
+// their document, as aliases cannot refer across "---" or "...".
+func Lint(data []byte) []LintWarning {
+	tokens, err := lexer.NewScanner(bytes.NewReader(data)).Tokens()
+	if err != nil {
+		return []LintWarning{{Kind: LintSyntaxError, Message: err.Error()}}
+	}
+
+	type definition struct {
+		token lexer.Token
+		used  bool
+	}
+	var warnings []LintWarning
+	defined := make(map[string]*definition)
+
+	reportUnused := func(def *definition) {
+		if !def.used {
+			warnings = append(warnings, LintWarning{
+				Kind:    LintUnusedAnchor,
+				Line:    def.token.Line,
+				Column:  def.token.Column,
+				Message: fmt.Sprintf("anchor &%s is never used", def.token.Value),
+			})
+		}
+	}
+	endDocument := func() {
+		for _, def := range defined {
+			reportUnused(def)
+		}
+		defined = make(map[string]*definition)
+	}
+
+	for _, token := range tokens {
+		switch token.Type {
+		case lexer.TokenAnchor:
+			if prev, ok := defined[token.Value]; ok {
+				reportUnused(prev)
+				warnings = append(warnings, LintWarning{
+					Kind:   LintDuplicateAnchor,
+					Line:   token.Line,
+					Column: token.Column,
+					Message: fmt.Sprintf("duplicate anchor &%s, first defined on line %d",
+						token.Value, prev.token.Line),
+				})
+			}
+			defined[token.Value] = &definition{token: token}
+
+		case lexer.TokenAlias:
+			if def, ok := defined[token.Value]; ok {
+				def.used = true
+			} else {
+				warnings = append(warnings, LintWarning{
+					Kind:    LintUndefinedAlias,
+					Line:    token.Line,
+					Column:  token.Column,
+					Message: fmt.Sprintf("alias *%s refers to an undefined anchor", token.Value),
+				})
+			}
+
+		case lexer.TokenDocumentStart, lexer.TokenDocumentEnd, lexer.TokenEOF:
+			endDocument()
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
+		return warnings[i].Column < warnings[j].Column
+	})
+	return warnings
+}
@@ -0,0 +1,79 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []LintWarning
+	}{
+		{
+			name:     "all anchors used",
+			input:    "base: &base\n  a: 1\nchild: *base\n",
+			expected: nil,
+		},
+		{
+			name:  "unused anchor",
+			input: "a: &x 1\nb: 2\n",
+			expected: []LintWarning{
+				{Kind: LintUnusedAnchor, Line: 1, Column: 4, Message: "anchor &x is never used"},
+			},
+		},
+		{
+			name:  "redefined anchor",
+			input: "a: &x 1\nb: *x\nc: &x 2\nd: *x\n",
+			expected: []LintWarning{
+				{Kind: LintDuplicateAnchor, Line: 3, Column: 4, Message: "duplicate anchor &x, first defined on line 1"},
+			},
+		},
+		{
+			name:  "redefined before use",
+			input: "a: &x 1\nc: &x 2\nd: *x\n",
+			expected: []LintWarning{
+				{Kind: LintUnusedAnchor, Line: 1, Column: 4, Message: "anchor &x is never used"},
+				{Kind: LintDuplicateAnchor, Line: 2, Column: 4, Message: "duplicate anchor &x, first defined on line 1"},
+			},
+		},
+		{
+			name:  "anchors are scoped to their document",
+			input: "a: &x 1\n---\nb: *x\n",
+			expected: []LintWarning{
+				{Kind: LintUnusedAnchor, Line: 1, Column: 4, Message: "anchor &x is never used"},
+				{Kind: LintUndefinedAlias, Line: 3, Column: 4, Message: "alias *x refers to an undefined anchor"},
+			},
+		},
+		{
+			name:  "document end marker ends anchor scope",
+			input: "a: &x 1\n...\nb: *x\n",
+			expected: []LintWarning{
+				{Kind: LintUnusedAnchor, Line: 1, Column: 4, Message: "anchor &x is never used"},
+				{Kind: LintUndefinedAlias, Line: 3, Column: 4, Message: "alias *x refers to an undefined anchor"},
+			},
+		},
+		{
+			name:     "document end followed by start",
+			input:    "a: &x 1\nb: *x\n...\n---\nc: &y 2\nd: *y\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lint([]byte(tt.input))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Lint() got = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("syntax error", func(t *testing.T) {
+		got := Lint([]byte("a: \"unterminated\n"))
+		if len(got) != 1 || got[0].Kind != LintSyntaxError {
+			t.Errorf("Lint() got = %+v, want one syntax error", got)
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package yaml
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"golang-yaml/v1/ast"
+	"golang-yaml/v1/parser"
 )
 
 type MergeMode int
@@ -22,9 +25,53 @@ type MergeOptions struct {
 	PreserveComments   bool
 	PreserveOrder      bool
 	AllowTypeMismatch  bool
-	CustomMergeFunc    func(path string, a, b interface{}) (interface{}, error)
+
+	// CustomMergeFunc is called before the default merge for every pair of
+	// values present on both sides. Returning nil falls through to the
+	// default merge, returning MergeDelete, MergeKeepBase or
+	// MergeKeepOverride selects that behavior, and any other value replaces
+	// the pair. A non-nil error aborts the merge.
+	CustomMergeFunc func(path string, a, b interface{}) (interface{}, error)
+
+	// MergeKey is the mapping key ArrayMergeByKey and ArrayUnionByKey match
+	// sequence items on. It defaults to "name".
+	MergeKey string
+
+	// DeleteOnNull removes a key from the result when the override sets it
+	// to null, instead of setting the value to null.
+	DeleteOnNull bool
+
+	// PathStrategies overrides ArrayMergeStrategy for the sequences at the
+	// given dotted paths, such as "spec.containers". A key ending in "*"
+	// applies to every path it is a prefix of, e.g. "spec.*"; an exact key
+	// takes precedence over wildcards, and a longer wildcard over a shorter
+	// one.
+	PathStrategies map[string]ArrayMergeStrategy
+
+	// KeepBaseOnNull keeps the base value when the override sets it to
+	// null. By default null overrides the value like any other. It has no
+	// effect on keys that DeleteOnNull removes.
+	KeepBaseOnNull bool
+}
+
+type mergeSentinel struct {
+	name string
 }
 
+// Sentinel results for MergeOptions.CustomMergeFunc.
+var (
+	// MergeDelete removes the value from the merged result.
+	MergeDelete = &mergeSentinel{"delete"}
+	// MergeKeepBase keeps the base value unchanged.
+	MergeKeepBase = &mergeSentinel{"keep base"}
+	// MergeKeepOverride takes the override value unchanged.
+	MergeKeepOverride = &mergeSentinel{"keep override"}
+)
+
+// errMergeDelete is returned by mergeNodesRecursive when a CustomMergeFunc
+// asked for the value to be removed from its parent.
+var errMergeDelete = errors.New("merge: value deleted")
+
 type ArrayMergeStrategy int
 
 const (
@@ -33,15 +80,19 @@ const (
 	ArrayMergeByIndex
 	ArrayMergeByKey
 	ArrayUnion
+	// ArrayUnionByKey is like ArrayUnion, but mapping items whose MergeKey
+	// field matches an earlier item are duplicates. Each duplicate is merged
+	// into the first occurrence according to Mode, so later items win.
+	ArrayUnionByKey
 )
 
 func Merge(a, b []byte, opts ...MergeOptions) ([]byte, error) {
-	nodeA, err := UnmarshalNode(a)
+	nodeA, err := parser.Parse(a)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse first document: %w", err)
 	}
 
-	nodeB, err := UnmarshalNode(b)
+	nodeB, err := parser.Parse(b)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse second document: %w", err)
 	}
@@ -65,21 +116,49 @@ func Merge(a, b []byte, opts ...MergeOptions) ([]byte, error) {
 }
 
 func MergeNodes(a, b ast.Node, opts MergeOptions) (ast.Node, error) {
-	return mergeNodesRecursive(a, b, opts, "")
+	merged, err := mergeNodesRecursive(a, b, opts, "")
+	if errors.Is(err, errMergeDelete) {
+		return nil, nil
+	}
+	return merged, err
 }
 
 func mergeNodesRecursive(a, b ast.Node, opts MergeOptions, path string) (ast.Node, error) {
+	a, b = ast.Resolve(a), ast.Resolve(b)
+
 	if opts.CustomMergeFunc != nil {
-		result, err := opts.CustomMergeFunc(path, nodeToInterface(a), nodeToInterface(b))
-		if err == nil && result != nil {
+		aValue, err := nodeToInterface(a)
+		if err != nil {
+			return nil, err
+		}
+		bValue, err := nodeToInterface(b)
+		if err != nil {
+			return nil, err
+		}
+		result, err := opts.CustomMergeFunc(path, aValue, bValue)
+		if err != nil {
+			return nil, fmt.Errorf("custom merge at %s: %w", path, err)
+		}
+		switch result {
+		case nil:
+		case MergeDelete:
+			return nil, errMergeDelete
+		case MergeKeepBase:
+			return cloneNode(a), nil
+		case MergeKeepOverride:
+			return cloneNode(b), nil
+		default:
 			return interfaceToNode(result)
 		}
 	}
 
 	if a == nil {
+		if b == nil {
+			return nil, nil
+		}
 		return b.Clone(), nil
 	}
-	if b == nil {
+	if b == nil || (opts.KeepBaseOnNull && isNullNode(b)) {
 		return a.Clone(), nil
 	}
 
@@ -124,8 +203,18 @@ func mergeDocuments(a, b *ast.Document, opts MergeOptions, path string) (ast.Nod
 	} else if len(b.Content) == 0 {
 		merged.Content = cloneNodes(a.Content)
 	} else {
+		// Paths within a lone document start at its root, so they read the
+		// same as when merging the root nodes directly
+		single := len(a.Content) == 1 && len(b.Content) == 1
 		for i := 0; i < len(a.Content) && i < len(b.Content); i++ {
-			node, err := mergeNodesRecursive(a.Content[i], b.Content[i], opts, fmt.Sprintf("%s[%d]", path, i))
+			docPath := fmt.Sprintf("%s[%d]", path, i)
+			if single {
+				docPath = path
+			}
+			node, err := mergeNodesRecursive(a.Content[i], b.Content[i], opts, docPath)
+			if errors.Is(err, errMergeDelete) {
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -194,6 +283,10 @@ func mergeMappings(a, b *ast.Mapping, opts MergeOptions, path string) (ast.Node,
 		aEntry := aMap[key]
 		bEntry := bMap[key]
 
+		if bEntry != nil && opts.DeleteOnNull && isNullNode(bEntry.Value) {
+			continue
+		}
+
 		if aEntry == nil && bEntry != nil {
 			merged.Content = append(merged.Content, cloneEntry(bEntry))
 		} else if aEntry != nil && bEntry == nil {
@@ -207,6 +300,9 @@ func mergeMappings(a, b *ast.Mapping, opts MergeOptions, path string) (ast.Node,
 				opts,
 				fmt.Sprintf("%s.%s", path, key),
 			)
+			if errors.Is(err, errMergeDelete) {
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -226,7 +322,7 @@ func mergeMappings(a, b *ast.Mapping, opts MergeOptions, path string) (ast.Node,
 
 	if opts.Mode != MergePreserve {
 		for _, key := range bKeys {
-			if !processedKeys[key] {
+			if !processedKeys[key] && !(opts.DeleteOnNull && isNullNode(bMap[key].Value)) {
 				merged.Content = append(merged.Content, cloneEntry(bMap[key]))
 			}
 		}
@@ -235,6 +331,24 @@ func mergeMappings(a, b *ast.Mapping, opts MergeOptions, path string) (ast.Node,
 	return merged, nil
 }
 
+// arrayStrategy returns the strategy for merging the sequences at path,
+// consulting opts.PathStrategies before opts.ArrayMergeStrategy.
+func arrayStrategy(opts MergeOptions, path string) ArrayMergeStrategy {
+	path = strings.TrimPrefix(path, ".")
+	if strategy, ok := opts.PathStrategies[path]; ok {
+		return strategy
+	}
+
+	strategy, longest := opts.ArrayMergeStrategy, -1
+	for pattern, s := range opts.PathStrategies {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			strategy, longest = s, len(prefix)
+		}
+	}
+	return strategy
+}
+
 func mergeSequences(a, b *ast.Sequence, opts MergeOptions, path string) (ast.Node, error) {
 	merged := &ast.Sequence{
 		Style: a.Style,
@@ -244,7 +358,7 @@ func mergeSequences(a, b *ast.Sequence, opts MergeOptions, path string) (ast.Nod
 		merged.SetComment(mergeComments(a.GetComment(), b.GetComment()))
 	}
 
-	switch opts.ArrayMergeStrategy {
+	switch arrayStrategy(opts, path) {
 	case ArrayReplace:
 		merged.Content = cloneNodes(b.Content)
 
@@ -268,6 +382,9 @@ func mergeSequences(a, b *ast.Sequence, opts MergeOptions, path string) (ast.Nod
 					opts,
 					fmt.Sprintf("%s[%d]", path, i),
 				)
+				if errors.Is(err, errMergeDelete) {
+					continue
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -280,22 +397,93 @@ func mergeSequences(a, b *ast.Sequence, opts MergeOptions, path string) (ast.Nod
 			merged.Content = append(merged.Content, node)
 		}
 
-	case ArrayUnion:
-		seen := make(map[string]bool)
-		for _, item := range a.Content {
-			key := nodeToString(item)
-			if !seen[key] {
+	case ArrayMergeByKey:
+		mergeKey := opts.MergeKey
+		if mergeKey == "" {
+			mergeKey = "name"
+		}
+
+		bItems := make(map[string]ast.Node)
+		for _, item := range b.Content {
+			if key, ok := sequenceItemKey(item, mergeKey); ok {
+				bItems[key] = item
+			}
+		}
+
+		matched := make(map[string]bool)
+		for i, item := range a.Content {
+			key, ok := sequenceItemKey(item, mergeKey)
+			if !ok || bItems[key] == nil {
 				merged.Content = append(merged.Content, item.Clone())
-				seen[key] = true
+				continue
+			}
+			node, err := mergeNodesRecursive(item, bItems[key], opts, fmt.Sprintf("%s[%d]", path, i))
+			matched[key] = true
+			if errors.Is(err, errMergeDelete) {
+				continue
 			}
+			if err != nil {
+				return nil, err
+			}
+			merged.Content = append(merged.Content, node)
 		}
+
 		for _, item := range b.Content {
-			key := nodeToString(item)
-			if !seen[key] {
-				merged.Content = append(merged.Content, item.Clone())
-				seen[key] = true
+			if key, ok := sequenceItemKey(item, mergeKey); ok && matched[key] {
+				continue
+			}
+			merged.Content = append(merged.Content, item.Clone())
+		}
+
+	case ArrayUnion:
+		for _, items := range [][]ast.Node{a.Content, b.Content} {
+			for _, item := range items {
+				if !containsNode(merged.Content, item) {
+					merged.Content = append(merged.Content, item.Clone())
+				}
+			}
+		}
+
+	case ArrayUnionByKey:
+		mergeKey := opts.MergeKey
+		if mergeKey == "" {
+			mergeKey = "name"
+		}
+
+		positions := make(map[string]int)
+		for _, items := range [][]ast.Node{a.Content, b.Content} {
+			for _, item := range items {
+				key, ok := sequenceItemKey(item, mergeKey)
+				if !ok {
+					if !containsNode(merged.Content, item) {
+						merged.Content = append(merged.Content, item.Clone())
+					}
+					continue
+				}
+
+				i, seen := positions[key]
+				if !seen {
+					positions[key] = len(merged.Content)
+					merged.Content = append(merged.Content, item.Clone())
+					continue
+				}
+				node, err := mergeNodesRecursive(merged.Content[i], item, opts, fmt.Sprintf("%s[%d]", path, i))
+				if errors.Is(err, errMergeDelete) {
+					delete(positions, key)
+				} else if err != nil {
+					return nil, err
+				}
+				merged.Content[i] = node
+			}
+		}
+
+		kept := merged.Content[:0]
+		for _, node := range merged.Content {
+			if node != nil {
+				kept = append(kept, node)
 			}
 		}
+		merged.Content = kept
 
 	default:
 		merged.Content = cloneNodes(b.Content)
@@ -304,6 +492,23 @@ func mergeSequences(a, b *ast.Sequence, opts MergeOptions, path string) (ast.Nod
 	return merged, nil
 }
 
+// sequenceItemKey returns the scalar value stored under key when item is a
+// mapping, identifying the item for ArrayMergeByKey.
+func sequenceItemKey(item ast.Node, key string) (string, bool) {
+	mapping, ok := item.(*ast.Mapping)
+	if !ok {
+		return "", false
+	}
+	for _, entry := range mapping.Content {
+		if getNodeStringValue(entry.Key) == key {
+			if scalar, ok := entry.Value.(*ast.Scalar); ok {
+				return scalar.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
 func mergeScalars(a, b *ast.Scalar, opts MergeOptions, path string) (ast.Node, error) {
 	if opts.Mode == MergeOverride || opts.Mode == MergeDeep {
 		merged := b.Clone().(*ast.Scalar)
@@ -389,20 +594,15 @@ func cloneEntry(entry *ast.MappingEntry) *ast.MappingEntry {
 		return nil
 	}
 	return &ast.MappingEntry{
-		Key:     entry.Key.Clone(),
-		Value:   entry.Value.Clone(),
+		Key:     cloneNode(entry.Key),
+		Value:   cloneNode(entry.Value),
 		Comment: entry.Comment,
 	}
 }
 
-func nodeToString(node ast.Node) string {
-	data, _ := MarshalNode(node)
-	return string(data)
-}
-
 func interfaceToNode(v interface{}) (ast.Node, error) {
 	enc := NewEncoder(nil)
-	return enc.valueToNode(reflect.ValueOf(v))
+	return enc.valueToNode(reflect.ValueOf(v), "")
 }
 
 func MergeValue(a, b interface{}, opts ...MergeOptions) (interface{}, error) {
@@ -447,3 +647,244 @@ func Patch(base []byte, patches ...[]byte) ([]byte, error) {
 
 	return result, nil
 }
+
+// Conflict describes a value that both sides of a three-way merge changed
+// differently. Path is the dotted location of the value, e.g. "server.port".
+type Conflict struct {
+	Path   string
+	Base   interface{}
+	Ours   interface{}
+	Theirs interface{}
+}
+
+// Merge3 merges the changes that ours and theirs each made to base. A value
+// changed on only one side takes that side. Mappings changed on both sides
+// are merged key by key; any other value changed differently on both sides is
+// reported as a Conflict and resolved by merging theirs over ours with opts.
+func Merge3(base, ours, theirs []byte, opts MergeOptions) ([]byte, []Conflict, error) {
+	var roots [3]ast.Node
+	for i, data := range [][]byte{base, ours, theirs} {
+		node, err := parser.Parse(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s document: %w", []string{"base", "ours", "theirs"}[i], err)
+		}
+		roots[i] = documentRoot(node)
+	}
+
+	var conflicts []Conflict
+	merged, err := merge3Nodes(roots[0], roots[1], roots[2], opts, "", &conflicts)
+	if errors.Is(err, errMergeDelete) {
+		merged, err = nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := MarshalNode(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, conflicts, nil
+}
+
+func merge3Nodes(base, ours, theirs ast.Node, opts MergeOptions, path string, conflicts *[]Conflict) (ast.Node, error) {
+	base, ours, theirs = ast.Resolve(base), ast.Resolve(ours), ast.Resolve(theirs)
+
+	switch {
+	case ast.Equal(ours, theirs), ast.Equal(base, theirs):
+		return cloneNode(ours), nil
+	case ast.Equal(base, ours):
+		return cloneNode(theirs), nil
+	}
+
+	baseMapping, baseOK := base.(*ast.Mapping)
+	oursMapping, oursOK := ours.(*ast.Mapping)
+	theirsMapping, theirsOK := theirs.(*ast.Mapping)
+	if baseOK && oursOK && theirsOK {
+		return merge3Mappings(baseMapping, oursMapping, theirsMapping, opts, path, conflicts)
+	}
+
+	conflict := Conflict{Path: path}
+	for _, side := range []struct {
+		node  ast.Node
+		value *interface{}
+	}{{base, &conflict.Base}, {ours, &conflict.Ours}, {theirs, &conflict.Theirs}} {
+		value, err := nodeToInterface(side.node)
+		if err != nil {
+			return nil, err
+		}
+		*side.value = value
+	}
+	*conflicts = append(*conflicts, conflict)
+	return mergeNodesRecursive(ours, theirs, opts, path)
+}
+
+func merge3Mappings(base, ours, theirs *ast.Mapping, opts MergeOptions, path string, conflicts *[]Conflict) (ast.Node, error) {
+	merged := &ast.Mapping{
+		Style: ours.Style,
+	}
+	merged.SetComment(ours.GetComment())
+
+	lookup := func(mapping *ast.Mapping) map[string]*ast.MappingEntry {
+		entries := make(map[string]*ast.MappingEntry)
+		for _, entry := range mapping.Content {
+			entries[getNodeStringValue(entry.Key)] = entry
+		}
+		return entries
+	}
+	baseEntries, oursEntries, theirsEntries := lookup(base), lookup(ours), lookup(theirs)
+
+	var keys []*ast.MappingEntry
+	seen := make(map[string]bool)
+	for _, mapping := range []*ast.Mapping{ours, theirs, base} {
+		for _, entry := range mapping.Content {
+			key := getNodeStringValue(entry.Key)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, entry)
+			}
+		}
+	}
+
+	valueOf := func(entries map[string]*ast.MappingEntry, key string) (ast.Node, bool) {
+		entry, ok := entries[key]
+		if !ok {
+			return nil, false
+		}
+		if entry.Value == nil {
+			return newNullScalar(), true
+		}
+		return entry.Value, true
+	}
+
+	for _, keyEntry := range keys {
+		key := getNodeStringValue(keyEntry.Key)
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+
+		baseValue, _ := valueOf(baseEntries, key)
+		oursValue, inOurs := valueOf(oursEntries, key)
+		theirsValue, inTheirs := valueOf(theirsEntries, key)
+
+		value, err := merge3Nodes(baseValue, oursValue, theirsValue, opts, childPath, conflicts)
+		if errors.Is(err, errMergeDelete) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if value == nil && !(inOurs && inTheirs) {
+			continue
+		}
+
+		entry := &ast.MappingEntry{Key: keyEntry.Key.Clone(), Value: value}
+		if source, ok := oursEntries[key]; ok {
+			entry.Comment = source.Comment
+		} else if source, ok := theirsEntries[key]; ok {
+			entry.Comment = source.Comment
+		}
+		merged.Content = append(merged.Content, entry)
+	}
+
+	return merged, nil
+}
+
+func containsNode(nodes []ast.Node, node ast.Node) bool {
+	for _, n := range nodes {
+		if ast.Equal(n, node) {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneNode(node ast.Node) ast.Node {
+	if node == nil {
+		return nil
+	}
+	return node.Clone()
+}
+
+func newNullScalar() *ast.Scalar {
+	node := ast.NewScalar("")
+	node.SetTag("!!null")
+	return node
+}
+
+// MergePatch applies patch to base with JSON Merge Patch (RFC 7386)
+// semantics: mappings merge recursively, a null value removes the key from
+// base, and every other value, including sequences, replaces the base value.
+func MergePatch(base, patch []byte) ([]byte, error) {
+	baseNode, err := parser.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base document: %w", err)
+	}
+
+	patchNode, err := parser.Parse(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse patch document: %w", err)
+	}
+
+	target := documentRoot(baseNode)
+	patchRoot := documentRoot(patchNode)
+	if patchRoot == nil {
+		return MarshalNode(baseNode)
+	}
+
+	return MarshalNode(mergePatchNodes(target, patchRoot))
+}
+
+func mergePatchNodes(target, patch ast.Node) ast.Node {
+	target, patch = ast.Resolve(target), ast.Resolve(patch)
+	patchMapping, ok := patch.(*ast.Mapping)
+	if !ok {
+		return patch.Clone()
+	}
+
+	result := ast.NewMapping()
+	if targetMapping, ok := target.(*ast.Mapping); ok {
+		result = targetMapping.Clone().(*ast.Mapping)
+	}
+
+	for _, entry := range patchMapping.Content {
+		key := getNodeStringValue(entry.Key)
+		index := -1
+		for i, existing := range result.Content {
+			if getNodeStringValue(existing.Key) == key {
+				index = i
+				break
+			}
+		}
+
+		if isNullNode(entry.Value) {
+			if index >= 0 {
+				result.Content = append(result.Content[:index], result.Content[index+1:]...)
+			}
+			continue
+		}
+
+		if index >= 0 {
+			result.Content[index].Value = mergePatchNodes(result.Content[index].Value, entry.Value)
+		} else {
+			result.Content = append(result.Content, &ast.MappingEntry{
+				Key:     entry.Key.Clone(),
+				Value:   mergePatchNodes(nil, entry.Value),
+				Comment: entry.Comment,
+			})
+		}
+	}
+
+	return result
+}
+
+func documentRoot(node ast.Node) ast.Node {
+	if doc, ok := node.(*ast.Document); ok {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		return doc.Content[0]
+	}
+	return node
+}
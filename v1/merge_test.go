@@ -0,0 +1,677 @@
+package yaml
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang-yaml/v1/ast"
+)
+
+func newTestMapping(entries ...*ast.MappingEntry) *ast.Mapping {
+	mapping := ast.NewMapping()
+	mapping.Content = entries
+	return mapping
+}
+
+func newTestEntry(key string, value ast.Node) *ast.MappingEntry {
+	return &ast.MappingEntry{Key: ast.NewScalar(key), Value: value}
+}
+
+func newTestSequence(items ...ast.Node) *ast.Sequence {
+	sequence := ast.NewSequence()
+	sequence.Content = items
+	return sequence
+}
+
+func newTestNull() *ast.Scalar {
+	node := ast.NewScalar("")
+	node.SetTag("!!null")
+	return node
+}
+
+func mustInterface(t *testing.T, node ast.Node) interface{} {
+	t.Helper()
+	value, err := nodeToInterface(node)
+	if err != nil {
+		t.Fatalf("nodeToInterface() error = %v", err)
+	}
+	return value
+}
+
+func TestMergeNodes_ByKey(t *testing.T) {
+	base := newTestMapping(
+		newTestEntry("containers", newTestSequence(
+			newTestMapping(
+				newTestEntry("name", ast.NewScalar("web")),
+				newTestEntry("image", ast.NewScalar("nginx:1.0")),
+				newTestEntry("port", ast.NewScalar("80")),
+			),
+			newTestMapping(
+				newTestEntry("name", ast.NewScalar("sidecar")),
+				newTestEntry("image", ast.NewScalar("proxy:1.0")),
+			),
+		)),
+	)
+
+	override := newTestMapping(
+		newTestEntry("containers", newTestSequence(
+			newTestMapping(
+				newTestEntry("name", ast.NewScalar("web")),
+				newTestEntry("image", ast.NewScalar("nginx:2.0")),
+			),
+			newTestMapping(
+				newTestEntry("name", ast.NewScalar("logger")),
+				newTestEntry("image", ast.NewScalar("fluentd")),
+			),
+		)),
+	)
+
+	merged, err := MergeNodes(base, override, MergeOptions{
+		Mode:               MergeDeep,
+		ArrayMergeStrategy: ArrayMergeByKey,
+	})
+	if err != nil {
+		t.Fatalf("MergeNodes() error = %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{"name": "web", "image": "nginx:2.0", "port": int64(80)},
+			map[string]interface{}{"name": "sidecar", "image": "proxy:1.0"},
+			map[string]interface{}{"name": "logger", "image": "fluentd"},
+		},
+	}
+	if got := mustInterface(t, merged); !reflect.DeepEqual(got, expected) {
+		t.Errorf("MergeNodes() got = %v, want %v", got, expected)
+	}
+
+	if got := base.Content[0].Value.(*ast.Sequence).Content[0].(*ast.Mapping).Content[1].Value.(*ast.Scalar).Value; got != "nginx:1.0" {
+		t.Errorf("MergeNodes() modified its input: image = %s", got)
+	}
+}
+
+func TestMerge_PathStrategies(t *testing.T) {
+	base := `spec:
+  containers:
+    - name: web
+      image: nginx:1.0
+    - name: sidecar
+      image: proxy:1.0
+  args: [--verbose, --port=80]
+  volumes: [data]
+logs: [started]
+`
+	override := `spec:
+  containers:
+    - name: web
+      image: nginx:2.0
+  args: [--port=8080]
+  volumes: [cache]
+logs: [restarted]
+`
+
+	tests := []struct {
+		name       string
+		strategies map[string]ArrayMergeStrategy
+		expected   map[string]interface{}
+	}{
+		{
+			name: "exact paths",
+			strategies: map[string]ArrayMergeStrategy{
+				"spec.containers": ArrayMergeByKey,
+				"spec.args":       ArrayReplace,
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "image": "nginx:2.0"},
+						map[string]interface{}{"name": "sidecar", "image": "proxy:1.0"},
+					},
+					"args":    []interface{}{"--port=8080"},
+					"volumes": []interface{}{"data", "cache"},
+				},
+				"logs": []interface{}{"started", "restarted"},
+			},
+		},
+		{
+			name: "wildcard",
+			strategies: map[string]ArrayMergeStrategy{
+				"spec.*":          ArrayReplace,
+				"spec.containers": ArrayMergeByKey,
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "image": "nginx:2.0"},
+						map[string]interface{}{"name": "sidecar", "image": "proxy:1.0"},
+					},
+					"args":    []interface{}{"--port=8080"},
+					"volumes": []interface{}{"cache"},
+				},
+				"logs": []interface{}{"started", "restarted"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := Merge([]byte(base), []byte(override), MergeOptions{
+				Mode:               MergeDeep,
+				ArrayMergeStrategy: ArrayAppend,
+				PathStrategies:     tt.strategies,
+			})
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+
+			var got map[string]interface{}
+			if err := Unmarshal(merged, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Merge() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeNodes_CustomMergeKey(t *testing.T) {
+	base := newTestSequence(
+		newTestMapping(newTestEntry("id", ast.NewScalar("1")), newTestEntry("v", ast.NewScalar("a"))),
+	)
+	override := newTestSequence(
+		newTestMapping(newTestEntry("id", ast.NewScalar("1")), newTestEntry("v", ast.NewScalar("b"))),
+	)
+
+	merged, err := MergeNodes(base, override, MergeOptions{
+		Mode:               MergeDeep,
+		ArrayMergeStrategy: ArrayMergeByKey,
+		MergeKey:           "id",
+	})
+	if err != nil {
+		t.Fatalf("MergeNodes() error = %v", err)
+	}
+
+	sequence := merged.(*ast.Sequence)
+	if len(sequence.Content) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(sequence.Content))
+	}
+	if v := sequence.Content[0].(*ast.Mapping).Content[1].Value.(*ast.Scalar).Value; v != "b" {
+		t.Errorf("expected v = b, got %s", v)
+	}
+}
+
+func TestMergeNodes_ArrayUnion(t *testing.T) {
+	quoted := ast.NewScalar("b")
+	quoted.Style = ast.DoubleQuotedStyle
+	commented := ast.NewScalar("a")
+	commented.SetComment(ast.Comment{LineComment: "# again"})
+
+	base := newTestSequence(ast.NewScalar("a"), ast.NewScalar("b"))
+	override := newTestSequence(
+		quoted,
+		commented,
+		newTestMapping(newTestEntry("x", ast.NewScalar("1")), newTestEntry("y", ast.NewScalar("2"))),
+		newTestMapping(newTestEntry("y", ast.NewScalar("2")), newTestEntry("x", ast.NewScalar("1"))),
+		ast.NewScalar("c"),
+	)
+
+	merged, err := MergeNodes(base, override, MergeOptions{
+		Mode:               MergeDeep,
+		ArrayMergeStrategy: ArrayUnion,
+	})
+	if err != nil {
+		t.Fatalf("MergeNodes() error = %v", err)
+	}
+
+	expected := []interface{}{"a", "b", map[string]interface{}{"x": int64(1), "y": int64(2)}, "c"}
+	if got := mustInterface(t, merged); !reflect.DeepEqual(got, expected) {
+		t.Errorf("MergeNodes() got = %v, want %v", got, expected)
+	}
+}
+
+func TestMergeNodes_ArrayUnionByKey(t *testing.T) {
+	item := func(name, image string) *ast.Mapping {
+		return newTestMapping(newTestEntry("name", ast.NewScalar(name)), newTestEntry("image", ast.NewScalar(image)))
+	}
+
+	base := newTestSequence(
+		item("web", "nginx:1.0"),
+		item("web", "nginx:1.1"),
+		item("db", "postgres"),
+		ast.NewScalar("plain"),
+	)
+	override := newTestSequence(
+		item("cache", "redis"),
+		newTestMapping(newTestEntry("name", ast.NewScalar("web")), newTestEntry("port", ast.NewScalar("80"))),
+		ast.NewScalar("plain"),
+	)
+
+	tests := []struct {
+		name     string
+		mode     MergeMode
+		expected []interface{}
+	}{
+		{
+			name: "deep",
+			mode: MergeDeep,
+			expected: []interface{}{
+				map[string]interface{}{"name": "web", "image": "nginx:1.1", "port": int64(80)},
+				map[string]interface{}{"name": "db", "image": "postgres"},
+				"plain",
+				map[string]interface{}{"name": "cache", "image": "redis"},
+			},
+		},
+		{
+			name: "preserve",
+			mode: MergePreserve,
+			expected: []interface{}{
+				map[string]interface{}{"name": "web", "image": "nginx:1.0", "port": int64(80)},
+				map[string]interface{}{"name": "db", "image": "postgres"},
+				"plain",
+				map[string]interface{}{"name": "cache", "image": "redis"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeNodes(base, override, MergeOptions{
+				Mode:               tt.mode,
+				ArrayMergeStrategy: ArrayUnionByKey,
+			})
+			if err != nil {
+				t.Fatalf("MergeNodes() error = %v", err)
+			}
+			if got := mustInterface(t, merged); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("MergeNodes() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeNodes_DeleteOnNull(t *testing.T) {
+	base := newTestMapping(
+		newTestEntry("name", ast.NewScalar("app")),
+		newTestEntry("debug", ast.NewScalar("true")),
+		newTestEntry("server", newTestMapping(
+			newTestEntry("host", ast.NewScalar("localhost")),
+			newTestEntry("port", ast.NewScalar("8080")),
+		)),
+	)
+
+	override := newTestMapping(
+		newTestEntry("debug", newTestNull()),
+		newTestEntry("server", newTestMapping(
+			newTestEntry("host", ast.NewScalar("~")),
+		)),
+		newTestEntry("extra", newTestNull()),
+	)
+
+	tests := []struct {
+		name     string
+		delete   bool
+		expected map[string]interface{}
+	}{
+		{
+			name:   "delete on null",
+			delete: true,
+			expected: map[string]interface{}{
+				"name":   "app",
+				"server": map[string]interface{}{"port": int64(8080)},
+			},
+		},
+		{
+			name:   "null overrides",
+			delete: false,
+			expected: map[string]interface{}{
+				"name":   "app",
+				"debug":  nil,
+				"server": map[string]interface{}{"host": nil, "port": int64(8080)},
+				"extra":  nil,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeNodes(base, override, MergeOptions{
+				Mode:         MergeDeep,
+				DeleteOnNull: tt.delete,
+			})
+			if err != nil {
+				t.Fatalf("MergeNodes() error = %v", err)
+			}
+
+			if got := mustInterface(t, merged); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("MergeNodes() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMerge_KeepBaseOnNull(t *testing.T) {
+	base := "timeout: 30\nserver:\n  host: localhost\n"
+
+	tests := []struct {
+		name     string
+		override string
+		keep     bool
+		expected map[string]interface{}
+	}{
+		{
+			name:     "null overrides value",
+			override: "timeout: null\nretries: null\n",
+			keep:     false,
+			expected: map[string]interface{}{
+				"timeout": nil,
+				"server":  map[string]interface{}{"host": "localhost"},
+				"retries": nil,
+			},
+		},
+		{
+			name:     "null keeps base",
+			override: "timeout: null\nretries: null\n",
+			keep:     true,
+			expected: map[string]interface{}{
+				"timeout": int64(30),
+				"server":  map[string]interface{}{"host": "localhost"},
+				"retries": nil,
+			},
+		},
+		{
+			name:     "null keeps base mapping",
+			override: "server: ~\n",
+			keep:     true,
+			expected: map[string]interface{}{
+				"timeout": int64(30),
+				"server":  map[string]interface{}{"host": "localhost"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := Merge([]byte(base), []byte(tt.override), MergeOptions{
+				Mode:           MergeDeep,
+				KeepBaseOnNull: tt.keep,
+			})
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+
+			var got map[string]interface{}
+			if err := Unmarshal(merged, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Merge() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeNodes_CustomMergeFunc(t *testing.T) {
+	base := "name: app\nport: 8080\ninternal_id: 1\ninternal_tag: a\ntags: [a]"
+	override := "name: service\nport: 9090\ninternal_id: 2\ninternal_tag: b\ntags: [b]"
+
+	tests := []struct {
+		name     string
+		fn       func(path string, a, b interface{}) (interface{}, error)
+		expected map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "delete keys with prefix",
+			fn: func(path string, a, b interface{}) (interface{}, error) {
+				if strings.HasPrefix(path, ".internal_") {
+					return MergeDelete, nil
+				}
+				return nil, nil
+			},
+			expected: map[string]interface{}{
+				"name": "service",
+				"port": int64(9090),
+				"tags": []interface{}{"b"},
+			},
+		},
+		{
+			name: "keep base",
+			fn: func(path string, a, b interface{}) (interface{}, error) {
+				if path == ".port" || path == ".tags" {
+					return MergeKeepBase, nil
+				}
+				return nil, nil
+			},
+			expected: map[string]interface{}{
+				"name":         "service",
+				"port":         int64(8080),
+				"internal_id":  int64(2),
+				"internal_tag": "b",
+				"tags":         []interface{}{"a"},
+			},
+		},
+		{
+			name: "keep override",
+			fn: func(path string, a, b interface{}) (interface{}, error) {
+				if path == "" {
+					return MergeKeepOverride, nil
+				}
+				return MergeKeepBase, nil
+			},
+			expected: map[string]interface{}{
+				"name":         "service",
+				"port":         int64(9090),
+				"internal_id":  int64(2),
+				"internal_tag": "b",
+				"tags":         []interface{}{"b"},
+			},
+		},
+		{
+			name: "replacement value",
+			fn: func(path string, a, b interface{}) (interface{}, error) {
+				if path == ".port" {
+					return a.(int64) + b.(int64), nil
+				}
+				return nil, nil
+			},
+			expected: map[string]interface{}{
+				"name":         "service",
+				"port":         int64(17170),
+				"internal_id":  int64(2),
+				"internal_tag": "b",
+				"tags":         []interface{}{"b"},
+			},
+		},
+		{
+			name: "error aborts",
+			fn: func(path string, a, b interface{}) (interface{}, error) {
+				if path == ".name" {
+					return nil, errors.New("name is immutable")
+				}
+				return nil, nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeA, _ := UnmarshalNode([]byte(base))
+			nodeB, _ := UnmarshalNode([]byte(override))
+
+			merged, err := MergeNodes(documentRoot(nodeA), documentRoot(nodeB), MergeOptions{Mode: MergeDeep, CustomMergeFunc: tt.fn})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MergeNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := mustInterface(t, merged); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("MergeNodes() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		patch    string
+		expected interface{}
+	}{
+		{
+			name:  "null deletes key",
+			base:  "name: app\ndebug: true\nport: 8080",
+			patch: "debug: null\nport: 9090",
+			expected: map[string]interface{}{
+				"name": "app",
+				"port": int64(9090),
+			},
+		},
+		{
+			name:  "nested removal",
+			base:  "server:\n  host: localhost\n  tls:\n    cert: a.pem\n    key: a.key",
+			patch: "server:\n  tls:\n    key: ~",
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{
+					"host": "localhost",
+					"tls":  map[string]interface{}{"cert": "a.pem"},
+				},
+			},
+		},
+		{
+			name:  "arrays replace",
+			base:  "tags: [a, b, c]",
+			patch: "tags: [d]",
+			expected: map[string]interface{}{
+				"tags": []interface{}{"d"},
+			},
+		},
+		{
+			name:  "new object drops nested nulls",
+			base:  "a: 1",
+			patch: "b: {c: null, d: 2}",
+			expected: map[string]interface{}{
+				"a": int64(1),
+				"b": map[string]interface{}{"d": int64(2)},
+			},
+		},
+		{
+			name:  "mapping replaces scalar",
+			base:  "a: plain",
+			patch: "a: {b: 1}",
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"b": int64(1)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := MergePatch([]byte(tt.base), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("MergePatch() error = %v", err)
+			}
+
+			var got interface{}
+			if err := Unmarshal(patched, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v\n%s", err, patched)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("MergePatch() got = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		expected  interface{}
+		conflicts []Conflict
+	}{
+		{
+			name:   "divergent edits",
+			base:   "name: app\nport: 8080\ndebug: false",
+			ours:   "name: app\nport: 9090\ndebug: false",
+			theirs: "name: service\nport: 8080\ndebug: false\nreplicas: 3",
+			expected: map[string]interface{}{
+				"name":     "service",
+				"port":     int64(9090),
+				"debug":    false,
+				"replicas": int64(3),
+			},
+		},
+		{
+			name:   "deletion on one side",
+			base:   "a: 1\nb: 2",
+			ours:   "a: 1",
+			theirs: "a: 1\nb: 2",
+			expected: map[string]interface{}{
+				"a": int64(1),
+			},
+		},
+		{
+			name:   "identical edits",
+			base:   "server:\n  port: 80",
+			ours:   "server:\n  port: 443",
+			theirs: "server:\n  port: 443",
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{"port": int64(443)},
+			},
+		},
+		{
+			name:   "conflicting edits",
+			base:   "server:\n  host: localhost\n  port: 80",
+			ours:   "server:\n  host: example.com\n  port: 443",
+			theirs: "server:\n  host: localhost\n  port: 8443",
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{"host": "example.com", "port": int64(8443)},
+			},
+			conflicts: []Conflict{
+				{Path: "server.port", Base: int64(80), Ours: int64(443), Theirs: int64(8443)},
+			},
+		},
+		{
+			name:   "modify and delete",
+			base:   "a: 1\nb: 2",
+			ours:   "a: 1\nb: 3",
+			theirs: "a: 1",
+			expected: map[string]interface{}{
+				"a": int64(1),
+				"b": int64(3),
+			},
+			conflicts: []Conflict{
+				{Path: "b", Base: int64(2), Ours: int64(3), Theirs: nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts, err := Merge3([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), MergeOptions{Mode: MergeDeep})
+			if err != nil {
+				t.Fatalf("Merge3() error = %v", err)
+			}
+
+			var got interface{}
+			if err := Unmarshal(merged, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v\n%s", err, merged)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Merge3() got = %v, want %v", got, tt.expected)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("Merge3() conflicts = %+v, want %+v", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
@@ -18,6 +18,24 @@ type Parser struct {
 	anchors      map[string]ast.Node
 	comments     []lexer.Token
 	indentLevel  int // Track current indentation level
+	err          error
+
+	maxAliasExpansions int
+	aliasExpansions    int
+	preserveAliases    bool
+	collectErrors      bool
+	errors             []*SyntaxError
+}
+
+// SyntaxError describes a malformed construct found while parsing.
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
 }
 
 func NewParser(r io.Reader) *Parser {
@@ -28,52 +46,147 @@ func NewParser(r io.Reader) *Parser {
 	}
 }
 
+// SetMaxAliasExpansions limits how many nodes aliases may copy into the
+// document in total, guarding against "billion laughs" documents whose nested
+// aliases grow exponentially. Zero, the default, means no limit.
+func (p *Parser) SetMaxAliasExpansions(n int) {
+	p.maxAliasExpansions = n
+}
+
+// SetPreserveAliases keeps each alias as an *ast.Alias referring to its
+// anchored node instead of replacing it with a copy, so the document can be
+// re-encoded with its anchors and aliases intact.
+func (p *Parser) SetPreserveAliases(enabled bool) {
+	p.preserveAliases = enabled
+}
+
+// Anchors returns the anchors defined by the parsed document, mapped to the
+// nodes they name. When a name is defined more than once, the last
+// definition wins. The map is a copy and may be modified freely.
+func (p *Parser) Anchors() map[string]ast.Node {
+	anchors := make(map[string]ast.Node, len(p.anchors))
+	for name, node := range p.anchors {
+		anchors[name] = node
+	}
+	return anchors
+}
+
+// SetCollectErrors makes the parser continue past malformed mapping entries
+// by skipping to the next line. Parse then returns the partial document
+// along with the first error, and Errors returns all of them. Without it,
+// Parse stops at the first malformed entry and returns its *SyntaxError.
+func (p *Parser) SetCollectErrors(enabled bool) {
+	p.collectErrors = enabled
+}
+
+// Errors returns the syntax errors collected while parsing with
+// SetCollectErrors enabled.
+func (p *Parser) Errors() []*SyntaxError {
+	return p.errors
+}
+
+// recoverLine reports a syntax error at pos. With SetCollectErrors enabled
+// it records the error, skips the rest of the current line and returns nil
+// so parsing can continue; otherwise it returns the error.
+func (p *Parser) recoverLine(pos ast.Position, message string) error {
+	err := &SyntaxError{Line: pos.Line, Column: pos.Column, Message: message}
+	if !p.collectErrors {
+		return err
+	}
+	p.errors = append(p.errors, err)
+	for p.currentToken.Type != lexer.TokenNewLine && p.currentToken.Type != lexer.TokenEOF &&
+		p.currentToken.Type != lexer.TokenError {
+		p.advance()
+	}
+	return nil
+}
+
+func (p *Parser) tokenPosition() ast.Position {
+	return ast.Position{Line: p.currentToken.Line, Column: p.currentToken.Column, Offset: p.currentToken.Offset}
+}
+
 func (p *Parser) Parse() (ast.Node, error) {
-	token, err := p.scanner.Scan()
-	if err != nil {
-		return nil, err
+	p.advance()
+	if p.err != nil {
+		return nil, p.err
 	}
-	p.currentToken = token
 	if debug {
 		fmt.Printf("Parse: initial token = %v\n", p.currentToken)
 	}
 
 	doc := ast.NewDocument()
 
+	for p.currentToken.Type == lexer.TokenDirective {
+		directive := p.currentToken
+		if fields := strings.Fields(directive.Value); len(fields) > 0 && fields[0] == "YAML" {
+			if len(fields) != 2 || !strings.HasPrefix(fields[1], "1.") {
+				return nil, fmt.Errorf("unsupported YAML directive %q at line %d, column %d", directive.Value, directive.Line, directive.Column)
+			}
+			doc.Version = fields[1]
+		}
+		p.advance()
+		p.skipNewlines()
+	}
+
+	// Comments set apart from the content by a blank line describe the
+	// document rather than its first node
+	p.collectComments()
+	if detached := p.takeDetachedComments(); detached != "" {
+		doc.SetComment(ast.Comment{HeadComment: detached})
+	}
+
 	// Check if the document starts with a mapping at column 1
-	if p.isMapping() && p.currentToken.Column == 1 {
+	rootMapping := p.isMapping() && p.currentToken.Column == 1
+	if rootMapping {
 		// Parse as a single root mapping
 		mapping, err := p.parseMapping()
 		if err != nil {
 			return nil, err
 		}
 		doc.Content = append(doc.Content, mapping)
-	} else {
-		// Parse multiple values
-		for p.currentToken.Type != lexer.TokenEOF {
-			if debug {
-				fmt.Printf("Parse loop: currentToken = %v\n", p.currentToken)
-			}
-			if p.currentToken.Type == lexer.TokenDocumentStart {
-				p.advance()
-			}
-
-			if p.currentToken.Type == lexer.TokenDocumentEnd {
-				p.advance()
-				continue
-			}
+		p.skipNewlines()
+	}
 
-			node, err := p.parseValue()
-			if err != nil {
-				return nil, err
-			}
+	// Parse multiple values. After a root mapping only further documents
+	// may follow.
+	for p.currentToken.Type != lexer.TokenEOF {
+		if debug {
+			fmt.Printf("Parse loop: currentToken = %v\n", p.currentToken)
+		}
+		if rootMapping && p.currentToken.Type != lexer.TokenDocumentStart && p.currentToken.Type != lexer.TokenDocumentEnd {
+			break
+		}
 
-			if node != nil {
-				doc.Content = append(doc.Content, node)
-			}
+		if p.currentToken.Type == lexer.TokenDocumentStart {
+			p.advance()
+		}
 
+		// "..." ends the document, so whatever follows starts a new one
+		// even without a "---" marker
+		if p.currentToken.Type == lexer.TokenDocumentEnd {
+			p.advance()
 			p.skipNewlines()
+			rootMapping = false
+			continue
 		}
+
+		node, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if node != nil {
+			doc.Content = append(doc.Content, node)
+		}
+
+		p.skipNewlines()
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.errors) > 0 {
+		return doc, p.errors[0]
 	}
 
 	return doc, nil
@@ -94,9 +207,11 @@ func (p *Parser) parseValue() (ast.Node, error) {
 	case lexer.TokenDocumentEnd:
 		return nil, nil
 
+	case lexer.TokenError:
+		return nil, p.err
+
 	case lexer.TokenNull:
-		node := ast.NewScalar("")
-		node.SetTag("!!null")
+		node := newNullNode()
 		p.attachComments(node)
 		p.advance()
 		return node, nil
@@ -134,6 +249,7 @@ func (p *Parser) parseValue() (ast.Node, error) {
 			return p.parseMapping()
 		}
 		node := ast.NewScalar(p.currentToken.Value)
+		node.Style = scalarStyle(p.currentToken)
 		node.SetTag("!!str")
 		p.attachComments(node)
 		p.advance()
@@ -171,19 +287,44 @@ func (p *Parser) parseValue() (ast.Node, error) {
 		if err != nil {
 			return nil, err
 		}
+		if node != nil {
+			node.SetAnchor(anchorName)
+		}
 		p.anchors[anchorName] = node
 		return node, nil
 
 	case lexer.TokenAlias:
-		aliasName := p.currentToken.Value
+		aliasToken := p.currentToken
 		p.advance()
-		if node, ok := p.anchors[aliasName]; ok {
-			return node.Clone(), nil
+		if node, ok := p.anchors[aliasToken.Value]; ok {
+			if p.preserveAliases {
+				alias := ast.NewAlias(aliasToken.Value)
+				alias.Value = node
+				alias.SetPosition(ast.Position{
+					Line:   aliasToken.Line,
+					Column: aliasToken.Column,
+					Offset: aliasToken.Offset,
+				})
+				return alias, nil
+			}
+			if p.maxAliasExpansions > 0 {
+				p.aliasExpansions += countNodes(node)
+				if p.aliasExpansions > p.maxAliasExpansions {
+					return nil, fmt.Errorf("alias expansion limit of %d nodes exceeded at line %d, column %d",
+						p.maxAliasExpansions, aliasToken.Line, aliasToken.Column)
+				}
+			}
+			clone := node.Clone()
+			clone.SetAnchor("")
+			return clone, nil
 		}
-		return nil, fmt.Errorf("undefined alias: %s", aliasName)
+		return nil, fmt.Errorf("undefined alias: %s at line %d, column %d", aliasToken.Value, aliasToken.Line, aliasToken.Column)
 
 	case lexer.TokenTag:
-		tag := p.currentToken.Value
+		// The scanner drops the leading '!', so restore it: tags read back
+		// exactly as written, "!!str" or "!custom", matching the "!!str"
+		// style of the tags resolved for untagged scalars.
+		tag := "!" + p.currentToken.Value
 		p.advance()
 		node, err := p.parseValue()
 		if err != nil {
@@ -192,6 +333,9 @@ func (p *Parser) parseValue() (ast.Node, error) {
 		if node != nil {
 			node.SetTag(tag)
 		}
+		if scalar, ok := node.(*ast.Scalar); ok {
+			scalar.ExplicitTag = true
+		}
 		return node, nil
 
 
@@ -222,7 +366,10 @@ func (p *Parser) parseSequence() (ast.Node, error) {
 	sequence := ast.NewSequence()
 	p.attachComments(sequence)
 
-	for p.currentToken.Type == lexer.TokenSequenceItem {
+	// Items of this sequence share the column of the first dash; a dash
+	// at any other column belongs to an enclosing or nested sequence
+	column := p.currentToken.Column
+	for p.currentToken.Type == lexer.TokenSequenceItem && p.currentToken.Column == column {
 		p.advance()
 		p.skipNewlines()
 		p.collectComments()
@@ -231,6 +378,9 @@ func (p *Parser) parseSequence() (ast.Node, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		p.attachLineComment(value)
+
 		if value != nil {
 			sequence.Content = append(sequence.Content, value)
 		}
@@ -245,6 +395,7 @@ func (p *Parser) parseFlowSequence() (ast.Node, error) {
 	sequence := ast.NewSequence()
 	sequence.Style = ast.FlowStyle
 	p.attachComments(sequence)
+	start := p.currentToken
 	p.advance()
 
 	for p.currentToken.Type != lexer.TokenFlowSequenceEnd {
@@ -255,6 +406,14 @@ func (p *Parser) parseFlowSequence() (ast.Node, error) {
 			break
 		}
 
+		if p.currentToken.Type == lexer.TokenEOF {
+			return nil, fmt.Errorf("unterminated flow sequence starting at line %d, column %d", start.Line, start.Column)
+		}
+
+		if p.currentToken.Type == lexer.TokenFlowEntry {
+			return nil, fmt.Errorf("empty entry in flow sequence at line %d, column %d", p.currentToken.Line, p.currentToken.Column)
+		}
+
 		value, err := p.parseValue()
 		if err != nil {
 			return nil, err
@@ -263,10 +422,12 @@ func (p *Parser) parseFlowSequence() (ast.Node, error) {
 			sequence.Content = append(sequence.Content, value)
 		}
 
+		p.attachLineComment(value)
 		p.skipNewlines()
 
 		if p.currentToken.Type == lexer.TokenFlowEntry {
 			p.advance()
+			p.attachLineComment(value)
 			p.skipNewlines()
 		}
 	}
@@ -295,7 +456,8 @@ func (p *Parser) parseMapping() (ast.Node, error) {
 		p.skipNewlines()
 		p.collectComments()
 
-		if p.currentToken.Type == lexer.TokenEOF || p.currentToken.Type == lexer.TokenDocumentEnd {
+		if p.currentToken.Type == lexer.TokenEOF || p.currentToken.Type == lexer.TokenDocumentEnd ||
+			p.currentToken.Type == lexer.TokenDocumentStart {
 			break
 		}
 
@@ -303,6 +465,10 @@ func (p *Parser) parseMapping() (ast.Node, error) {
 			break
 		}
 
+		if p.currentToken.Type == lexer.TokenError {
+			return nil, p.err
+		}
+
 		// Set the indentation level based on the first key
 		if firstKey {
 			startColumn = p.currentToken.Column
@@ -324,7 +490,23 @@ func (p *Parser) parseMapping() (ast.Node, error) {
 				if debug {
 					fmt.Printf("parseMapping: root mapping but column %d != 1, breaking\n", p.currentToken.Column)
 				}
-				break
+				if err := p.recoverLine(p.tokenPosition(), "unexpected indentation"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		// A comment block followed by a blank line belongs after the
+		// previous entry rather than above this key
+		if detached := p.takeDetachedComments(); detached != "" {
+			if len(mapping.Content) > 0 {
+				last := mapping.Content[len(mapping.Content)-1]
+				last.Comment.FootComment += detached
+			} else {
+				comment := mapping.GetComment()
+				comment.HeadComment += detached
+				mapping.SetComment(comment)
 			}
 		}
 
@@ -333,9 +515,18 @@ func (p *Parser) parseMapping() (ast.Node, error) {
 			if debug {
 				fmt.Printf("parseMapping: parseKey error: %v, currentToken = %v\n", err, p.currentToken)
 			}
-			break
+			if err := p.recoverLine(p.tokenPosition(), err.Error()); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
+		if p.currentToken.Type != lexer.TokenKey {
+			if err := p.recoverLine(key.Position(), "expected ':' after key"); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		p.skipNewlines()
 
 		if p.currentToken.Type != lexer.TokenKey {
@@ -343,27 +534,34 @@ func (p *Parser) parseMapping() (ast.Node, error) {
 		}
 		p.advance()
 
+		// A comment right after the ':' belongs to the entry, whatever
+		// follows on the next lines
+		var entryComment ast.Comment
+		if p.currentToken.Type == lexer.TokenComment {
+			entryComment.LineComment = p.currentToken.Value
+			p.advance()
+		}
+
+		valueOnNextLine := p.currentToken.Type == lexer.TokenNewLine
 		p.skipNewlines()
 		p.collectComments()
 
-		value, err := p.parseValue()
-		if err != nil {
-			return nil, err
-		}
-
-		// Check for inline comment after value
-		if p.currentToken.Type == lexer.TokenComment {
-			if value != nil {
-				comment := value.GetComment()
-				comment.LineComment = p.currentToken.Value
-				value.SetComment(comment)
+		// A key with nothing indented beneath it has a null value
+		var value ast.Node
+		if !valueOnNextLine || p.currentToken.Column > startColumn ||
+			(p.currentToken.Type == lexer.TokenSequenceItem && p.currentToken.Column == startColumn) {
+			value, err = p.parseValue()
+			if err != nil {
+				return nil, err
 			}
-			p.advance()
 		}
 
+		p.attachLineComment(value)
+
 		entry := &ast.MappingEntry{
-			Key:   key,
-			Value: value,
+			Key:     key,
+			Value:   value,
+			Comment: entryComment,
 		}
 
 		mapping.Content = append(mapping.Content, entry)
@@ -373,6 +571,8 @@ func (p *Parser) parseMapping() (ast.Node, error) {
 		}
 	}
 
+	p.attachFootComments(mapping, startColumn)
+
 	if debug {
 		fmt.Printf("parseMapping: returning, currentToken = %v\n", p.currentToken)
 	}
@@ -383,6 +583,7 @@ func (p *Parser) parseFlowMapping() (ast.Node, error) {
 	mapping := ast.NewMapping()
 	mapping.Style = ast.FlowStyle
 	p.attachComments(mapping)
+	start := p.currentToken
 	p.advance()
 
 	for p.currentToken.Type != lexer.TokenFlowMappingEnd {
@@ -393,6 +594,10 @@ func (p *Parser) parseFlowMapping() (ast.Node, error) {
 			break
 		}
 
+		if p.currentToken.Type == lexer.TokenEOF {
+			return nil, fmt.Errorf("unterminated flow mapping starting at line %d, column %d", start.Line, start.Column)
+		}
+
 		key, err := p.parseKey()
 		if err != nil {
 			return nil, err
@@ -400,17 +605,24 @@ func (p *Parser) parseFlowMapping() (ast.Node, error) {
 
 		p.skipNewlines()
 
-		if p.currentToken.Type != lexer.TokenKey {
-			return nil, fmt.Errorf("expected ':', got %s", p.currentToken.Type)
-		}
-		p.advance()
-
-		p.skipNewlines()
-		p.collectComments()
+		// A key may stand alone ({a, b: 1}) or have an empty value
+		// ({a: , b: 1}); both mean null.
+		var value ast.Node
+		switch p.currentToken.Type {
+		case lexer.TokenFlowEntry, lexer.TokenFlowMappingEnd:
+			value = newNullNode()
+		case lexer.TokenKey:
+			p.advance()
+			p.skipNewlines()
+			p.collectComments()
 
-		value, err := p.parseValue()
-		if err != nil {
-			return nil, err
+			if p.currentToken.Type == lexer.TokenFlowEntry || p.currentToken.Type == lexer.TokenFlowMappingEnd {
+				value = newNullNode()
+			} else if value, err = p.parseValue(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected ':', got %s", p.currentToken.Type)
 		}
 
 		entry := &ast.MappingEntry{
@@ -420,10 +632,12 @@ func (p *Parser) parseFlowMapping() (ast.Node, error) {
 
 		mapping.Content = append(mapping.Content, entry)
 
+		p.attachLineComment(value)
 		p.skipNewlines()
 
 		if p.currentToken.Type == lexer.TokenFlowEntry {
 			p.advance()
+			p.attachLineComment(value)
 			p.skipNewlines()
 		}
 	}
@@ -439,6 +653,7 @@ func (p *Parser) parseKey() (ast.Node, error) {
 	if p.currentToken.Type == lexer.TokenString || p.currentToken.Type == lexer.TokenNumber ||
 		p.currentToken.Type == lexer.TokenBoolean || p.currentToken.Type == lexer.TokenNull {
 		node := ast.NewScalar(p.currentToken.Value)
+		node.Style = scalarStyle(p.currentToken)
 		p.attachComments(node)
 		p.advance()
 		return node, nil
@@ -446,15 +661,31 @@ func (p *Parser) parseKey() (ast.Node, error) {
 	return nil, fmt.Errorf("expected key, got %s", p.currentToken.Type)
 }
 
+func newNullNode() *ast.Scalar {
+	node := ast.NewScalar("")
+	node.SetTag("!!null")
+	return node
+}
+
+func scalarStyle(token lexer.Token) ast.ScalarStyle {
+	switch token.Style {
+	case lexer.SingleQuotedScalar:
+		return ast.SingleQuotedStyle
+	case lexer.DoubleQuotedScalar:
+		return ast.DoubleQuotedStyle
+	default:
+		return ast.PlainStyle
+	}
+}
+
 func (p *Parser) parseNumber() ast.Node {
 	value := p.currentToken.Value
 	node := ast.NewScalar(value)
 
-	if strings.Contains(value, ".") || strings.Contains(value, "e") || strings.Contains(value, "E") ||
-		value == ".inf" || value == "-.inf" || value == ".nan" {
-		node.SetTag("!!float")
-	} else {
+	if lexer.IsInt(value) {
 		node.SetTag("!!int")
+	} else {
+		node.SetTag("!!float")
 	}
 
 	return node
@@ -472,7 +703,7 @@ func (p *Parser) isMapping() bool {
 		return false
 	}
 
-	nextToken, err := p.scanner.Scan()
+	nextToken, err := p.scanner.Peek()
 	if err != nil {
 		if debug {
 			fmt.Printf("isMapping: scan error: %v\n", err)
@@ -484,13 +715,16 @@ func (p *Parser) isMapping() bool {
 	if debug {
 		fmt.Printf("isMapping: nextToken = %v, isKey = %v\n", nextToken, isKey)
 	}
-	p.scanner.PushBack(nextToken)
 	return isKey
 }
 
 func (p *Parser) advance() {
+	if p.err != nil {
+		return
+	}
 	token, err := p.scanner.Scan()
 	if err != nil {
+		p.err = err
 		p.currentToken = lexer.Token{Type: lexer.TokenError, Value: err.Error()}
 		return
 	}
@@ -514,7 +748,14 @@ func (p *Parser) collectComments() {
 	}
 }
 
+// attachComments records the current token's position on node along with any
+// pending head comments.
 func (p *Parser) attachComments(node ast.Node) {
+	node.SetPosition(ast.Position{
+		Line:   p.currentToken.Line,
+		Column: p.currentToken.Column,
+		Offset: p.currentToken.Offset,
+	})
 	if len(p.comments) > 0 {
 		comment := ast.Comment{}
 		for _, c := range p.comments {
@@ -525,6 +766,86 @@ func (p *Parser) attachComments(node ast.Node) {
 	}
 }
 
+// attachLineComment consumes a comment that follows node on the same line
+// and records it as the node's line comment.
+func (p *Parser) attachLineComment(node ast.Node) {
+	if p.currentToken.Type != lexer.TokenComment {
+		return
+	}
+	if node != nil {
+		comment := node.GetComment()
+		comment.LineComment = p.currentToken.Value
+		node.SetComment(comment)
+	}
+	p.advance()
+}
+
+// takeDetachedComments removes and returns the pending comments that are
+// separated from the current token by a blank line. Comments directly above
+// the current token stay pending.
+func (p *Parser) takeDetachedComments() string {
+	split := 0
+	for i, c := range p.comments {
+		nextLine := p.currentToken.Line
+		if i+1 < len(p.comments) {
+			nextLine = p.comments[i+1].Line
+		}
+		if nextLine > c.Line+1 {
+			split = i + 1
+		}
+	}
+	if split == 0 {
+		return ""
+	}
+
+	var detached string
+	for _, c := range p.comments[:split] {
+		detached += c.Value + "\n"
+	}
+	p.comments = append(p.comments[:0], p.comments[split:]...)
+	return detached
+}
+
+// attachFootComments gives node the pending comments indented at least as
+// far as column. Less indented comments are left for an enclosing node.
+func (p *Parser) attachFootComments(node ast.Node, column int) {
+	n := 0
+	for n < len(p.comments) && p.comments[n].Column >= column {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	comment := node.GetComment()
+	for _, c := range p.comments[:n] {
+		comment.FootComment += c.Value + "\n"
+	}
+	node.SetComment(comment)
+	p.comments = append(p.comments[:0], p.comments[n:]...)
+}
+
+func countNodes(node ast.Node) int {
+	switch n := node.(type) {
+	case nil:
+		return 0
+	case *ast.Mapping:
+		count := 1
+		for _, entry := range n.Content {
+			count += countNodes(entry.Key) + countNodes(entry.Value)
+		}
+		return count
+	case *ast.Sequence:
+		count := 1
+		for _, item := range n.Content {
+			count += countNodes(item)
+		}
+		return count
+	default:
+		return 1
+	}
+}
+
 func Parse(data []byte) (ast.Node, error) {
 	return ParseReader(bytes.NewReader(data))
 }
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -23,6 +25,9 @@ func TestParser_Scalars(t *testing.T) {
 		{"float", "3.14", "3.14", "!!float"},
 		{"infinity", ".inf", ".inf", "!!float"},
 		{"not a number", ".nan", ".nan", "!!float"},
+		{"explicit core tag", "!!str 42", "42", "!!str"},
+		{"explicit binary tag", "!!binary aGVsbG8=", "aGVsbG8=", "!!binary"},
+		{"local tag", "!custom value", "value", "!custom"},
 	}
 
 	for _, tt := range tests {
@@ -54,6 +59,47 @@ func TestParser_Scalars(t *testing.T) {
 			if scalar.Tag() != tt.tag {
 				t.Errorf("expected tag %q, got %q", tt.tag, scalar.Tag())
 			}
+
+			if explicit := strings.HasPrefix(tt.input, "!"); scalar.ExplicitTag != explicit {
+				t.Errorf("expected ExplicitTag %v, got %v", explicit, scalar.ExplicitTag)
+			}
+		})
+	}
+}
+
+func TestParser_QuotingStyles(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		style    ast.ScalarStyle
+	}{
+		{"plain", "plain", "plain", ast.PlainStyle},
+		{"single quoted", "'it''s'", "it's", ast.SingleQuotedStyle},
+		{"double quoted", `"say \"hi\""`, `say "hi"`, ast.DoubleQuotedStyle},
+		{"quoted number", `"42"`, "42", ast.DoubleQuotedStyle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser(strings.NewReader(tt.input))
+			node, err := p.Parse()
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+
+			scalar, ok := node.(*ast.Document).Content[0].(*ast.Scalar)
+			if !ok {
+				t.Fatalf("expected Scalar, got %T", node.(*ast.Document).Content[0])
+			}
+
+			if scalar.Value != tt.expected {
+				t.Errorf("expected value %q, got %q", tt.expected, scalar.Value)
+			}
+
+			if scalar.Style != tt.style {
+				t.Errorf("expected style %v, got %v", tt.style, scalar.Style)
+			}
 		})
 	}
 }
@@ -257,6 +303,64 @@ key: value # inline comment`,
 	}
 }
 
+func TestParser_SequenceItemComments(t *testing.T) {
+	node, err := Parse([]byte("- a # first\n- b # second\n"))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	sequence, ok := node.(*ast.Document).Content[0].(*ast.Sequence)
+	if !ok {
+		t.Fatalf("expected Sequence, got %T", node.(*ast.Document).Content[0])
+	}
+
+	expected := []string{"first", "second"}
+	if len(sequence.Content) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(sequence.Content))
+	}
+	for i, item := range sequence.Content {
+		if got := item.GetComment().LineComment; got != expected[i] {
+			t.Errorf("item %d: expected line comment %q, got %q", i, expected[i], got)
+		}
+	}
+}
+
+func TestParser_DetachedComments(t *testing.T) {
+	input := `# document comment
+
+# about name
+name: app
+
+# section break
+
+# about port
+port: 8080
+`
+
+	node, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	doc := node.(*ast.Document)
+	if got := strings.TrimSpace(doc.GetComment().HeadComment); got != "document comment" {
+		t.Errorf("expected document comment, got %q", got)
+	}
+
+	mapping := doc.Content[0].(*ast.Mapping)
+	if got := strings.TrimSpace(mapping.GetComment().HeadComment); got != "about name" {
+		t.Errorf("expected attached head comment %q, got %q", "about name", got)
+	}
+
+	if got := strings.TrimSpace(mapping.Content[0].Comment.FootComment); got != "section break" {
+		t.Errorf("expected detached comment after name, got %q", got)
+	}
+
+	if got := strings.TrimSpace(mapping.Content[1].Key.GetComment().HeadComment); got != "about port" {
+		t.Errorf("expected attached head comment %q, got %q", "about port", got)
+	}
+}
+
 func TestParser_AnchorsAndAliases(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -303,6 +407,107 @@ service:
 	}
 }
 
+func TestParser_Anchors(t *testing.T) {
+	input := `defaults: &defaults
+  timeout: 30
+service:
+  <<: *defaults
+  port: 8080
+features:
+  - logging
+  - &metrics metrics
+aliases:
+  main_feature: *metrics`
+
+	p := NewParser(strings.NewReader(input))
+	if _, err := p.Parse(); err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	anchors := p.Anchors()
+	if len(anchors) != 2 {
+		t.Errorf("expected 2 anchors, got %d", len(anchors))
+	}
+	if _, ok := anchors["defaults"].(*ast.Mapping); !ok {
+		t.Errorf("expected defaults to name a mapping, got %v", anchors["defaults"])
+	}
+	if scalar, ok := anchors["metrics"].(*ast.Scalar); !ok || scalar.Value != "metrics" {
+		t.Errorf("expected metrics to name the scalar \"metrics\", got %v", anchors["metrics"])
+	}
+
+	delete(anchors, "defaults")
+	if _, ok := p.Anchors()["defaults"]; !ok {
+		t.Error("expected Anchors to return a copy")
+	}
+}
+
+func TestParser_CollectionAliases(t *testing.T) {
+	input := `list1: &list1
+  - a
+  - b
+  - c
+list2: *list1`
+
+	p := NewParser(strings.NewReader(input))
+	node, err := p.Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	mapping := node.(*ast.Document).Content[0].(*ast.Mapping)
+	if len(mapping.Content) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(mapping.Content))
+	}
+
+	original, ok := mapping.Content[0].Value.(*ast.Sequence)
+	if !ok {
+		t.Fatalf("expected Sequence for list1, got %T", mapping.Content[0].Value)
+	}
+	aliased, ok := mapping.Content[1].Value.(*ast.Sequence)
+	if !ok {
+		t.Fatalf("expected Sequence for list2, got %T", mapping.Content[1].Value)
+	}
+
+	if got := extractSequence(aliased); strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("expected aliased items [a b c], got %v", got)
+	}
+
+	aliased.Content[0].(*ast.Scalar).Value = "changed"
+	if original.Content[0].(*ast.Scalar).Value != "a" {
+		t.Error("alias should be a deep copy of the anchored sequence")
+	}
+}
+
+func TestParser_AliasExpansionLimit(t *testing.T) {
+	bomb := `a: &a [x, x, x, x]
+b: &b [*a, *a, *a, *a]
+c: &c [*b, *b, *b, *b]
+d: &d [*c, *c, *c, *c]
+e: [*d, *d, *d, *d]`
+
+	p := NewParser(strings.NewReader(bomb))
+	p.SetMaxAliasExpansions(100)
+	_, err := p.Parse()
+	if err == nil {
+		t.Fatal("expected alias expansion limit error")
+	}
+	if !strings.Contains(err.Error(), "alias expansion limit of 100 nodes exceeded") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	normal := `base: &base
+  host: localhost
+  port: 8080
+dev: *base
+prod: *base`
+
+	p = NewParser(strings.NewReader(normal))
+	p.SetMaxAliasExpansions(100)
+	if _, err := p.Parse(); err != nil {
+		t.Errorf("unexpected error for normal document: %v", err)
+	}
+}
+
 func TestParser_BlockScalars(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -386,6 +591,38 @@ doc2: value2
 	}
 }
 
+func TestParser_DocumentEndMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"end then start", "a: 1\n...\n---\nb: 2", []string{"Mapping(1 entries)", "Mapping(1 entries)"}},
+		{"end without start", "a: 1\n...\nb: 2\nc: 3\n", []string{"Mapping(1 entries)", "Mapping(2 entries)"}},
+		{"every document ended", "a: 1\n...\n---\nb: 2\n...\n---\nthird\n...\n", []string{"Mapping(1 entries)", "Mapping(1 entries)", "Scalar(third)"}},
+		{"scalar documents", "first\n...\nsecond\n", []string{"Scalar(first)", "Scalar(second)"}},
+		{"trailing end", "a: 1\n...\n", []string{"Mapping(1 entries)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := NewParser(strings.NewReader(tt.input)).Parse()
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+
+			doc := node.(*ast.Document)
+			var got []string
+			for _, content := range doc.Content {
+				got = append(got, content.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected documents %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestParser_ComplexDocument(t *testing.T) {
 	input := `# Application configuration
 name: MyApp
@@ -481,6 +718,117 @@ func TestParser_ErrorCases(t *testing.T) {
 	}
 }
 
+func TestParser_CollectErrors(t *testing.T) {
+	input := `a: 1
+]oops
+b: 2
+c d
+e: 5`
+
+	p := NewParser(strings.NewReader(input))
+	p.SetCollectErrors(true)
+	node, err := p.Parse()
+	if err == nil {
+		t.Fatal("expected the first error to be returned")
+	}
+
+	expected := []SyntaxError{
+		{Line: 2, Column: 1, Message: "expected key, got FlowSequenceEnd"},
+		{Line: 4, Column: 1, Message: "expected ':' after key"},
+	}
+	errs := p.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, want := range expected {
+		if *errs[i] != want {
+			t.Errorf("error %d: expected %+v, got %+v", i, want, *errs[i])
+		}
+	}
+	if err != errs[0] {
+		t.Errorf("expected Parse to return the first error, got %v", err)
+	}
+
+	mapping := node.(*ast.Document).Content[0].(*ast.Mapping)
+	var keys []string
+	for _, entry := range mapping.Content {
+		keys = append(keys, entry.Key.(*ast.Scalar).Value)
+	}
+	if got := strings.Join(keys, ","); got != "a,b,e" {
+		t.Errorf("expected keys a,b,e to survive, got %s", got)
+	}
+
+	p = NewParser(strings.NewReader("a: 1\nb: 2"))
+	p.SetCollectErrors(true)
+	if _, err := p.Parse(); err != nil || len(p.Errors()) != 0 {
+		t.Errorf("expected no errors for a valid document, got %v", p.Errors())
+	}
+}
+
+func TestParser_SyntaxErrorsWithoutCollect(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected SyntaxError
+	}{
+		{"missing colon", "a: 1\nb c\nd: 2\n", SyntaxError{Line: 2, Column: 1, Message: "expected ':' after key"}},
+		{"bad indentation", "key: value\n  bad: indent\nnext: 1\n", SyntaxError{Line: 2, Column: 3, Message: "unexpected indentation"}},
+		{"invalid key", "a: 1\n]oops\nb: 2", SyntaxError{Line: 2, Column: 1, Message: "expected key, got FlowSequenceEnd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(tt.input)).Parse()
+			syntaxErr, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected *SyntaxError, got %v", err)
+			}
+			if *syntaxErr != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *syntaxErr)
+			}
+		})
+	}
+}
+
+func TestParser_EmptyMappingValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		path  []string
+	}{
+		{"end of input", "a:", []string{"a"}},
+		{"followed by sibling", "a:\nb: 1", []string{"a"}},
+		{"line comment", "a: # nothing\nb: 1", []string{"a"}},
+		{"end of nested block", "x:\n  a:\ny: 1", []string{"x", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+
+			current := node.(*ast.Document).Content[0]
+			for _, key := range tt.path {
+				mapping, ok := current.(*ast.Mapping)
+				if !ok {
+					t.Fatalf("expected mapping at %s, got %T", key, current)
+				}
+				current = nil
+				for _, entry := range mapping.Content {
+					if entry.Key.(*ast.Scalar).Value == key {
+						current = entry.Value
+					}
+				}
+			}
+			if current != nil {
+				t.Errorf("expected nil value, got %#v", current)
+			}
+		})
+	}
+}
+
 func TestParser_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -618,4 +966,25 @@ features:
 		p := NewParser(strings.NewReader(input))
 		p.Parse()
 	}
-}
\ No newline at end of file
+}
+
+func BenchmarkParser_LargeDocument(b *testing.B) {
+	var buf strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&buf, "# service %d\n", i)
+		fmt.Fprintf(&buf, "service%d:\n", i)
+		fmt.Fprintf(&buf, "  name: svc-%d\n", i)
+		fmt.Fprintf(&buf, "  port: %d\n", 8000+i)
+		buf.WriteString("  enabled: true\n")
+		buf.WriteString("  tags: [web, api]\n")
+		buf.WriteString("  hosts:\n    - a.example.com\n    - b.example.com\n")
+	}
+	input := buf.String()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := NewParser(strings.NewReader(input))
+		p.Parse()
+	}
+}
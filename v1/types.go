@@ -19,3 +19,28 @@ const (
 	SortValues = ast.SortValues
 	SortBoth   = ast.SortBoth
 )
+
+// MapItem is a single key/value pair of a MapSlice.
+type MapItem struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// MapSlice is a mapping that keeps its key order. The encoder writes the
+// items in slice order instead of sorting them, and decoding a mapping into
+// a MapSlice fills it in document order, using MapSlice for nested mappings.
+type MapSlice []MapItem
+
+// RawNode holds part of a document undecoded. A struct field or other
+// target of type RawNode captures the node as parsed, so it can be decoded
+// later with Decode once its shape is known. The encoder writes the node
+// back out as is.
+type RawNode struct {
+	Node ast.Node
+}
+
+// Decode decodes the captured node into v using the default decoder
+// settings.
+func (r RawNode) Decode(v interface{}) error {
+	return DecodeNode(r.Node, v)
+}
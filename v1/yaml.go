@@ -2,7 +2,10 @@ package yaml
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"os"
+	"regexp"
 
 	"golang-yaml/v1/ast"
 	"golang-yaml/v1/parser"
@@ -20,16 +23,107 @@ func Marshal(v interface{}) ([]byte, error) {
 	var buf bytes.Buffer
 	enc := NewEncoder(&buf)
 	err := enc.Encode(v)
+	if err == nil {
+		err = enc.Close()
+	}
 	return buf.Bytes(), err
 }
 
+// MarshalIndent is like Marshal but indents nested collections by indent
+// spaces, which must be between 1 and 10.
+func MarshalIndent(v interface{}, indent int) ([]byte, error) {
+	if indent < 1 || indent > 10 {
+		return nil, fmt.Errorf("indent must be between 1 and 10, got %d", indent)
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetIndent(indent)
+	err := enc.Encode(v)
+	if err == nil {
+		err = enc.Close()
+	}
+	return buf.Bytes(), err
+}
+
+// MarshalWithOptions returns the YAML encoding of v using the settings in
+// opts.
+func MarshalWithOptions(v interface{}, opts EncoderOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if opts.Indent > 0 {
+		enc.SetIndent(opts.Indent)
+	}
+	enc.SetSortMapKeys(!opts.KeepMapOrder)
+	enc.SetNormalizeBooleans(opts.NormalizeBooleans)
+	enc.SetOmitEmptyDerefsPointers(opts.OmitEmptyDerefsPointers)
+	enc.lineWidth = opts.LineWidth
+	enc.stringStyle = opts.DefaultStringStyle
+	err := enc.Encode(v)
+	if err == nil {
+		err = enc.Close()
+	}
+	return buf.Bytes(), err
+}
+
+// MarshalCompact returns the YAML encoding of v on a single line, using flow
+// collections throughout and no optional whitespace, e.g. {"a":1,"b":[1,2]}.
+// Mapping keys are double-quoted so that YAML parsers read each ':' as a value
+// indicator rather than part of the key.
+func MarshalCompact(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.compact = true
+	err := enc.Encode(v)
+	if err == nil {
+		err = enc.Close()
+	}
+	return buf.Bytes(), err
+}
+
+// MarshalNode encodes node as YAML. Mapping entries are written in the order
+// they appear in the node, so a document read with UnmarshalNode keeps its
+// key order through a round trip.
 func MarshalNode(node ast.Node) ([]byte, error) {
 	var buf bytes.Buffer
 	enc := NewEncoder(&buf)
 	err := enc.EncodeNode(node)
+	if err == nil {
+		err = enc.Close()
+	}
 	return buf.Bytes(), err
 }
 
+// MarshalAll encodes each of docs as a separate document of a single stream,
+// separated by "---" markers.
+func MarshalAll(docs []ast.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, doc := range docs {
+		if err := enc.EncodeNode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalFile writes the YAML encoding of v to the file at path. The file is
+// created with permissions perm (before umask) if it does not exist, and
+// truncated otherwise, keeping its existing permissions, as with os.WriteFile.
+func MarshalFile(path string, v interface{}, perm os.FileMode) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// Unmarshal decodes data into v. Mappings decoded into interface{} values
+// become map[string]interface{}, which does not keep key order; re-encoding
+// such a value emits keys sorted. Decode into a struct, or use UnmarshalNode
+// and MarshalNode, when the original order matters.
 func Unmarshal(data []byte, v interface{}) error {
 	return UnmarshalReader(bytes.NewReader(data), v)
 }
@@ -39,10 +133,93 @@ func UnmarshalReader(r io.Reader, v interface{}) error {
 	return dec.Decode(v)
 }
 
+// UnmarshalFile reads the file at path and decodes its contents into v, as
+// with UnmarshalReader.
+func UnmarshalFile(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return UnmarshalReader(f, v)
+}
+
+// UnmarshalStrict is like Unmarshal but fails on mapping keys that match no
+// struct field, as with Decoder.SetStrict.
+func UnmarshalStrict(data []byte, v interface{}) error {
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.SetStrict(true)
+	return dec.Decode(v)
+}
+
+// UnmarshalWithEnv is like Unmarshal but first replaces ${VAR} in string
+// scalars with the value of the environment variable VAR, and ${VAR:-def}
+// with def when VAR is unset or empty. Unset variables without a default
+// expand to the empty string.
+func UnmarshalWithEnv(data []byte, v interface{}) error {
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.SetScalarHook(func(tag, value string) (string, bool) {
+		if tag != "!!str" || !envPattern.MatchString(value) {
+			return "", false
+		}
+		return expandEnv(value), true
+	})
+	return dec.Decode(v)
+}
+
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+func expandEnv(value string) string {
+	return envPattern.ReplaceAllStringFunc(value, func(match string) string {
+		groups := envPattern.FindStringSubmatch(match)
+		if env := os.Getenv(groups[1]); env != "" {
+			return env
+		}
+		return groups[2]
+	})
+}
+
+// Valid reports whether data is well-formed YAML. It returns the first
+// syntax error encountered, such as a *parser.SyntaxError for a mapping
+// entry without ':' or at the wrong indentation, or nil.
+func Valid(data []byte) error {
+	_, err := parser.Parse(data)
+	return err
+}
+
+// UnmarshalNode parses data into a node tree. Anchors are recorded on their
+// nodes and aliases are kept as *ast.Alias nodes, so MarshalNode writes them
+// back out unexpanded.
+//
+// Aliases used to be expanded into copies of the anchored node. Code that
+// walks the tree must now handle *ast.Alias, whose Value field holds the
+// anchored node; DecodeNode resolves aliases itself.
 func UnmarshalNode(data []byte) (ast.Node, error) {
-	return parser.Parse(data)
+	return UnmarshalNodeReader(bytes.NewReader(data))
 }
 
+// UnmarshalNodeReader is like UnmarshalNode but reads the document from r.
 func UnmarshalNodeReader(r io.Reader) (ast.Node, error) {
-	return parser.ParseReader(r)
+	p := parser.NewParser(r)
+	p.SetPreserveAliases(true)
+	return p.Parse()
+}
+
+// DecodeNode decodes node, typically a subtree of a document returned by
+// UnmarshalNode, into v using the default decoder settings, including the
+// DefaultMaxAliasExpansions limit.
+func DecodeNode(node ast.Node, v interface{}) error {
+	return NewDecoder(nil).DecodeNode(node, v)
+}
+
+// Transform calls fn for every scalar value in the tree under node with its
+// dotted path, as reported by ast.Walk. fn may modify the scalar in place,
+// for example to redact secrets before the tree is encoded again.
+func Transform(node ast.Node, fn func(path string, s *ast.Scalar)) {
+	ast.Walk(node, func(path string, n ast.Node) bool {
+		if scalar, ok := n.(*ast.Scalar); ok {
+			fn(path, scalar)
+		}
+		return true
+	})
 }
@@ -2,9 +2,15 @@ package yaml
 
 import (
 	"bytes"
+	"fmt"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"golang-yaml/v1/ast"
 )
 
 func TestBasicUnmarshal(t *testing.T) {
@@ -176,14 +182,14 @@ func TestYAML12Features(t *testing.T) {
 			want: math.Inf(-1),
 		},
 		{
-			name: "boolean yes",
+			name: "yes is a string",
 			yaml: "yes",
-			want: true,
+			want: "yes",
 		},
 		{
-			name: "boolean no",
+			name: "no is a string",
 			yaml: "no",
-			want: false,
+			want: "no",
 		},
 		{
 			name: "null tilde",
@@ -258,6 +264,23 @@ func TestFlowStyle(t *testing.T) {
 				"map":   map[string]interface{}{"a": "b"},
 			},
 		},
+		{
+			name: "flow mapping empty value",
+			yaml: "{a: , b: 1}",
+			want: map[string]interface{}{
+				"a": nil,
+				"b": int64(1),
+			},
+		},
+		{
+			name: "flow mapping key without value",
+			yaml: "{a, b: c, d:}",
+			want: map[string]interface{}{
+				"a": nil,
+				"b": "c",
+				"d": nil,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -332,3 +355,984 @@ doc: 2`
 	}
 
 }
+
+func TestQuotingRoundTrip(t *testing.T) {
+	input := `plain: value
+single: 'it''s here'
+double: "say \"hi\""
+"quoted key": 'quoted value'
+number: "8080"
+"a:b": 1
+'x #y': 2
+" padded ": 3
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("round trip mismatch:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+
+	var decoded map[string]interface{}
+	if err := Unmarshal(output, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	for _, key := range []string{"a:b", "x #y", " padded "} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("key %q missing after round trip: %v", key, decoded)
+		}
+	}
+
+	// Plain keys built in code are quoted when they would not parse back
+	mapping := ast.NewMapping()
+	for _, key := range []string{"a:b", " lead", "ok"} {
+		mapping.Content = append(mapping.Content, &ast.MappingEntry{Key: ast.NewScalar(key), Value: ast.NewScalar("v")})
+	}
+	output, err = MarshalNode(mapping)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+	if expected := "\"a:b\": v\n\" lead\": v\nok: v\n"; string(output) != expected {
+		t.Errorf("MarshalNode() got:\n%s\nwant:\n%s", output, expected)
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "valid document",
+			yaml: "name: app\nitems:\n  - a\n  - b\nflow: {a: [1, 2]}",
+		},
+		{
+			name: "empty document",
+			yaml: "",
+		},
+		{
+			name:    "unterminated double quote",
+			yaml:    "name: \"app",
+			wantErr: "unterminated double-quoted string at line 1, column 7",
+		},
+		{
+			name:    "unterminated single quote",
+			yaml:    "a: 1\nb: 'oops",
+			wantErr: "unterminated single-quoted string at line 2, column 4",
+		},
+		{
+			name:    "undefined alias",
+			yaml:    "a: 1\nb: *missing",
+			wantErr: "undefined alias: missing at line 2, column 4",
+		},
+		{
+			name:    "empty flow sequence entry",
+			yaml:    "[1, , 3]",
+			wantErr: "empty entry in flow sequence at line 1, column 5",
+		},
+		{
+			name:    "bare comma flow sequence",
+			yaml:    "[,]",
+			wantErr: "empty entry in flow sequence at line 1, column 2",
+		},
+		{
+			name:    "unterminated flow sequence",
+			yaml:    "a: [1, 2",
+			wantErr: "unterminated flow sequence starting at line 1, column 4",
+		},
+		{
+			name:    "tab indented nested key",
+			yaml:    "server:\n\thost: localhost\n\tport: 80",
+			wantErr: "tab character used for indentation at line 2",
+		},
+		{
+			name:    "key without colon",
+			yaml:    "a: 1\nb c\nd: 2\n",
+			wantErr: "expected ':' after key at line 2, column 1",
+		},
+		{
+			name:    "misindented key",
+			yaml:    "key: value\n  bad: indent\nnext: 1\n",
+			wantErr: "unexpected indentation at line 2, column 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Valid([]byte(tt.yaml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Valid() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Valid() expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Valid() error = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	type Config struct {
+		Name string `yaml:"name"`
+	}
+
+	data := []byte("name: app\nnmae: typo\n")
+
+	var lenient Config
+	if err := Unmarshal(data, &lenient); err != nil {
+		t.Fatalf("Unmarshal() unexpected error = %v", err)
+	}
+	if lenient.Name != "app" {
+		t.Errorf("Unmarshal() name = %q, want %q", lenient.Name, "app")
+	}
+
+	var strict Config
+	err := UnmarshalStrict(data, &strict)
+	if err == nil {
+		t.Fatal("UnmarshalStrict() expected error for unknown field")
+	}
+	if !strings.Contains(err.Error(), "field nmae not found") {
+		t.Errorf("UnmarshalStrict() error = %q", err)
+	}
+
+	if err := UnmarshalStrict([]byte("name: app\n"), &strict); err != nil {
+		t.Errorf("UnmarshalStrict() unexpected error = %v", err)
+	}
+}
+
+func TestUnmarshalWithEnv(t *testing.T) {
+	t.Setenv("YAML_ENV_HOST", "db.internal")
+	t.Setenv("YAML_ENV_EMPTY", "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"present", "value: ${YAML_ENV_HOST}", "db.internal"},
+		{"present with default", "value: ${YAML_ENV_HOST:-localhost}", "db.internal"},
+		{"missing with default", "value: ${YAML_ENV_MISSING:-localhost}", "localhost"},
+		{"empty with default", "value: ${YAML_ENV_EMPTY:-localhost}", "localhost"},
+		{"missing without default", "value: ${YAML_ENV_MISSING}", ""},
+		{"embedded", `value: "postgres://${YAML_ENV_HOST}:${YAML_ENV_PORT:-5432}/app"`, "postgres://db.internal:5432/app"},
+		{"no placeholder", "value: $YAML_ENV_HOST", "$YAML_ENV_HOST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config struct {
+				Value string `yaml:"value"`
+			}
+			if err := UnmarshalWithEnv([]byte(tt.input), &config); err != nil {
+				t.Fatalf("UnmarshalWithEnv() unexpected error = %v", err)
+			}
+			if config.Value != tt.want {
+				t.Errorf("UnmarshalWithEnv() value = %q, want %q", config.Value, tt.want)
+			}
+		})
+	}
+
+	var config struct {
+		Port int `yaml:"port"`
+	}
+	if err := UnmarshalWithEnv([]byte("port: ${YAML_ENV_PORT:-8080}"), &config); err != nil {
+		t.Fatalf("UnmarshalWithEnv() unexpected error = %v", err)
+	}
+	if config.Port != 8080 {
+		t.Errorf("UnmarshalWithEnv() port = %d, want 8080", config.Port)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	type Blob struct {
+		Name string `yaml:"name"`
+		Data []byte `yaml:"data"`
+	}
+
+	long := bytes.Repeat([]byte("0123456789"), 10)
+	tests := []struct {
+		name     string
+		input    Blob
+		expected string
+	}{
+		{
+			name:     "short",
+			input:    Blob{Name: "a", Data: []byte("hello")},
+			expected: "name: a\ndata: !!binary |-\n  aGVsbG8=\n",
+		},
+		{
+			name:  "wrapped",
+			input: Blob{Name: "b", Data: long},
+			expected: "name: b\ndata: !!binary |-\n" +
+				"  MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2\n" +
+				"  Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDEyMzQ1Njc4OQ==\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.input)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Marshal() got:\n%s\nwant:\n%s", data, tt.expected)
+			}
+
+			var decoded Blob
+			if err := Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.input) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", decoded, tt.input)
+			}
+		})
+	}
+
+	var generic map[string]interface{}
+	if err := Unmarshal([]byte("data: !!binary aGVsbG8="), &generic); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got, ok := generic["data"].([]byte); !ok || string(got) != "hello" {
+		t.Errorf("Unmarshal() data = %#v, want []byte(\"hello\")", generic["data"])
+	}
+
+	var blob Blob
+	if err := Unmarshal([]byte("data: !!binary not*base64"), &blob); err == nil {
+		t.Error("Unmarshal() expected error for invalid base64")
+	}
+
+	// Untagged scalars are stored as their text, not decoded as base64.
+	if err := Unmarshal([]byte("data: aGVsbG8="), &blob); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if string(blob.Data) != "aGVsbG8=" {
+		t.Errorf("Unmarshal() data = %q, want %q", blob.Data, "aGVsbG8=")
+	}
+}
+
+func TestSetRoundTrip(t *testing.T) {
+	type Config struct {
+		Tags map[string]struct{} `yaml:"tags"`
+	}
+	input := Config{Tags: map[string]struct{}{"web": {}, "db": {}}}
+
+	data, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	expected := "tags: !!set\n  db: null\n  web: null\n"
+	if string(data) != expected {
+		t.Errorf("Marshal() got:\n%s\nwant:\n%s", data, expected)
+	}
+
+	var decoded Config
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("Round-trip failed: got = %v, want %v", decoded, input)
+	}
+
+	var flags map[string]bool
+	if err := Unmarshal([]byte("!!set {web, db}"), &flags); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if expected := map[string]bool{"web": true, "db": true}; !reflect.DeepEqual(flags, expected) {
+		t.Errorf("Unmarshal() got = %v, want %v", flags, expected)
+	}
+
+	node, err := UnmarshalNode([]byte("tags: &t !!set {a: null, b: null}\n"))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+	if string(output) != "tags: &t !!set {a: null, b: null}\n" {
+		t.Errorf("MarshalNode() dropped the set tag: %q", output)
+	}
+
+	if err := Unmarshal([]byte("!!set {a: 1}"), &flags); err == nil {
+		t.Error("expected error for a !!set entry with a value")
+	}
+}
+
+func TestOmapRoundTrip(t *testing.T) {
+	input := MapSlice{
+		{Key: "zebra", Value: int64(1)},
+		{Key: "apple", Value: int64(2)},
+		{Key: "mango", Value: int64(3)},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOmap(true)
+	if err := enc.Encode(input); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	expected := "!!omap\n-\n  zebra: 1\n-\n  apple: 2\n-\n  mango: 3\n"
+	if buf.String() != expected {
+		t.Errorf("Encode() got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	var decoded MapSlice
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("Round-trip failed: got = %v, want %v", decoded, input)
+	}
+
+	if err := Unmarshal([]byte("!!omap\n- zebra: 1\n- apple: 2\n- mango: 3\n"), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, input) {
+		t.Errorf("Unmarshal() got = %v, want %v", decoded, input)
+	}
+
+	if err := Unmarshal([]byte("!!omap [{a: 1, b: 2}]"), &decoded); err == nil {
+		t.Error("expected error for an !!omap item with two entries")
+	}
+}
+
+func TestMarshalUnmarshalFile(t *testing.T) {
+	type Config struct {
+		Name     string            `yaml:"name"`
+		Port     int               `yaml:"port"`
+		Features []string          `yaml:"features"`
+		Labels   map[string]string `yaml:"labels"`
+	}
+
+	original := Config{
+		Name:     "app",
+		Port:     8080,
+		Features: []string{"logging", "metrics"},
+		Labels:   map[string]string{"env": "prod"},
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := MarshalFile(path, original, 0600); err != nil {
+		t.Fatalf("MarshalFile() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	var decoded Config
+	if err := UnmarshalFile(path, &decoded); err != nil {
+		t.Fatalf("UnmarshalFile() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(original, decoded) {
+		t.Errorf("Round-trip failed: got = %v, want %v", decoded, original)
+	}
+
+	if err := UnmarshalFile(filepath.Join(t.TempDir(), "missing.yaml"), &decoded); err == nil {
+		t.Error("UnmarshalFile() expected error for missing file")
+	}
+}
+
+func TestMarshalCompact(t *testing.T) {
+	value := map[string]interface{}{
+		"name":  "app",
+		"ports": []interface{}{int64(80), int64(443)},
+		"tls": map[string]interface{}{
+			"enabled": true,
+			"hosts":   []interface{}{"a.example.com", "b, c"},
+		},
+		"empty": []interface{}{},
+	}
+
+	data, err := MarshalCompact(value)
+	if err != nil {
+		t.Fatalf("MarshalCompact() error = %v", err)
+	}
+
+	expected := `{"empty":[],"name":app,"ports":[80,443],"tls":{"enabled":true,"hosts":[a.example.com,"b, c"]}}`
+	if string(data) != expected {
+		t.Errorf("MarshalCompact() got = %s, want %s", data, expected)
+	}
+
+	var decoded interface{}
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Round-trip failed: got = %v, want %v", decoded, value)
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	value := map[string]interface{}{
+		"server": map[string]interface{}{
+			"tls": map[string]interface{}{
+				"enabled": true,
+			},
+			"port": int64(8080),
+		},
+	}
+
+	data, err := MarshalIndent(value, 4)
+	if err != nil {
+		t.Fatalf("MarshalIndent() error = %v", err)
+	}
+	expected := "server:\n    port: 8080\n    tls:\n        enabled: true\n"
+	if string(data) != expected {
+		t.Errorf("MarshalIndent() got:\n%s\nwant:\n%s", data, expected)
+	}
+
+	var decoded interface{}
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Round-trip failed: got = %v, want %v", decoded, value)
+	}
+
+	for _, indent := range []int{0, -1, 11} {
+		if _, err := MarshalIndent(value, indent); err == nil {
+			t.Errorf("MarshalIndent(%d) expected error", indent)
+		}
+	}
+}
+
+func TestMarshalWithOptions(t *testing.T) {
+	value := map[string]interface{}{
+		"name": "app",
+		"server": map[string]interface{}{
+			"port": int64(8080),
+			"host": "localhost",
+		},
+		"description": "a service that answers requests from the outside world",
+	}
+
+	tests := []struct {
+		name     string
+		opts     EncoderOptions
+		expected string
+	}{
+		{
+			name: "defaults",
+			opts: EncoderOptions{},
+			expected: "description: a service that answers requests from the outside world\n" +
+				"name: app\nserver:\n  host: localhost\n  port: 8080\n",
+		},
+		{
+			name: "indent 4",
+			opts: EncoderOptions{Indent: 4},
+			expected: "description: a service that answers requests from the outside world\n" +
+				"name: app\nserver:\n    host: localhost\n    port: 8080\n",
+		},
+		{
+			name: "line width",
+			opts: EncoderOptions{LineWidth: 30},
+			expected: "description: >-\n  a service that answers\n  requests from the outside\n  world\n" +
+				"name: app\nserver:\n  host: localhost\n  port: 8080\n",
+		},
+		{
+			name: "default string style",
+			opts: EncoderOptions{DefaultStringStyle: ast.DoubleQuotedStyle},
+			expected: "\"description\": \"a service that answers requests from the outside world\"\n" +
+				"\"name\": \"app\"\n\"server\":\n  \"host\": \"localhost\"\n  \"port\": 8080\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalWithOptions(value, tt.opts)
+			if err != nil {
+				t.Fatalf("MarshalWithOptions() error = %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("MarshalWithOptions() got:\n%s\nwant:\n%s", data, tt.expected)
+			}
+
+			var decoded interface{}
+			if err := Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, value) {
+				t.Errorf("Round-trip failed: got = %v, want %v", decoded, value)
+			}
+		})
+	}
+
+	t.Run("zero options match Marshal", func(t *testing.T) {
+		want, err := Marshal(value)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		got, err := MarshalWithOptions(value, EncoderOptions{})
+		if err != nil {
+			t.Fatalf("MarshalWithOptions() error = %v", err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("MarshalWithOptions() got:\n%s\nwant:\n%s", got, want)
+		}
+	})
+
+	t.Run("keep map order", func(t *testing.T) {
+		data, err := MarshalWithOptions(value, EncoderOptions{KeepMapOrder: true})
+		if err != nil {
+			t.Fatalf("MarshalWithOptions() error = %v", err)
+		}
+
+		var decoded interface{}
+		if err := Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if !reflect.DeepEqual(decoded, value) {
+			t.Errorf("Round-trip failed: got = %v, want %v", decoded, value)
+		}
+	})
+}
+
+func TestMarshalAll(t *testing.T) {
+	first := ast.NewMapping()
+	first.Content = append(first.Content, &ast.MappingEntry{Key: ast.NewScalar("name"), Value: ast.NewScalar("first")})
+	second := ast.NewSequence()
+	second.Content = append(second.Content, ast.NewScalar("a"), ast.NewScalar("b"))
+	third := ast.NewDocument()
+	third.Content = append(third.Content, ast.NewScalar("third"))
+
+	data, err := MarshalAll([]ast.Node{first, second, third})
+	if err != nil {
+		t.Fatalf("MarshalAll() error = %v", err)
+	}
+
+	expected := "name: first\n\n---\n- a\n- b\n\n---\nthird\n"
+	if string(data) != expected {
+		t.Errorf("MarshalAll() got:\n%s\nwant:\n%s", data, expected)
+	}
+
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+	doc := node.(*ast.Document)
+	if len(doc.Content) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(doc.Content))
+	}
+
+	again, err := MarshalNode(doc)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+	if string(again) != expected {
+		t.Errorf("MarshalNode() got:\n%s\nwant:\n%s", again, expected)
+	}
+}
+
+func TestNodeKeyOrderRoundTrip(t *testing.T) {
+	input := `zebra: 1
+apple:
+  mango: x
+  banana: y
+  cherry: z
+items:
+  - second
+  - first
+kiwi: last
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("key order not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+}
+
+func TestBooleanSpellingRoundTrip(t *testing.T) {
+	input := `on: push
+enabled: yes
+debug: Off
+verbose: TRUE
+quoted: 'yes'
+flags: [on, no]
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+	if string(output) != input {
+		t.Errorf("boolean spelling not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetBoolStyle(BoolLegacy11)
+	enc.SetNormalizeBooleans(true)
+	if err := enc.EncodeNode(node); err != nil {
+		t.Fatalf("EncodeNode() error = %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	want := `on: push
+enabled: true
+debug: false
+verbose: true
+quoted: 'yes'
+flags: [true, false]
+`
+	if buf.String() != want {
+		t.Errorf("booleans not normalized:\nwant:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	if output, _ := MarshalNode(node); string(output) != input {
+		t.Errorf("normalizing modified the node:\n%s", output)
+	}
+
+	// Under YAML 1.2 only true and false are booleans.
+	core := `enabled: yes
+debug: Off
+verbose: TRUE
+`
+	for _, tt := range []struct {
+		name  string
+		input string
+		style BoolStyle
+	}{
+		{"default", core, BoolDefault},
+		{"1.2 directive", "%YAML 1.2\n---\n" + core, BoolLegacy11},
+		{"core bool style", core, BoolCore12},
+	} {
+		node, err := UnmarshalNode([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("%s: UnmarshalNode() error = %v", tt.name, err)
+		}
+		buf.Reset()
+		enc := NewEncoder(&buf)
+		enc.SetBoolStyle(tt.style)
+		enc.SetNormalizeBooleans(true)
+		if err := enc.EncodeNode(node); err != nil {
+			t.Fatalf("%s: EncodeNode() error = %v", tt.name, err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("flush error: %v", err)
+		}
+		want := "enabled: yes\ndebug: Off\nverbose: true\n"
+		if buf.String() != want {
+			t.Errorf("%s: want:\n%s\ngot:\n%s", tt.name, want, buf.String())
+		}
+	}
+}
+
+func TestNodeAnchorRoundTrip(t *testing.T) {
+	input := `defaults: &defaults
+  timeout: 30
+  retries: 3
+service1:
+  <<: *defaults
+  port: 8080
+service2:
+  <<: *defaults
+  port: 9090
+ports: &ports [80, 443]
+mirror: *ports
+name: &name primary
+alias: *name
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("anchors not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+
+	var decoded map[string]interface{}
+	if err := Unmarshal(output, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded["mirror"], decoded["ports"]) {
+		t.Errorf("alias decoded to %v, want %v", decoded["mirror"], decoded["ports"])
+	}
+}
+
+func TestDecodeNode(t *testing.T) {
+	input := `# deployment
+defaults: &defaults
+  timeout: 30
+server:
+  host: example.com # primary
+  ports: [80, 443]
+  limits: *defaults
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	doc, ok := node.(*ast.Document)
+	if !ok || len(doc.Content) != 1 {
+		t.Fatalf("expected a document with one root node, got %T", node)
+	}
+	root, ok := doc.Content[0].(*ast.Mapping)
+	if !ok {
+		t.Fatalf("expected a mapping root, got %T", doc.Content[0])
+	}
+
+	var server ast.Node
+	for _, entry := range root.Content {
+		if key, ok := entry.Key.(*ast.Scalar); ok && key.Value == "server" {
+			server = entry.Value
+		}
+	}
+	if server == nil {
+		t.Fatal("server entry not found")
+	}
+
+	type Server struct {
+		Host   string         `yaml:"host"`
+		Ports  []int          `yaml:"ports"`
+		Limits map[string]int `yaml:"limits"`
+	}
+	var result Server
+	if err := DecodeNode(server, &result); err != nil {
+		t.Fatalf("DecodeNode() error = %v", err)
+	}
+
+	expected := Server{
+		Host:   "example.com",
+		Ports:  []int{80, 443},
+		Limits: map[string]int{"timeout": 30},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("DecodeNode() got = %+v, want %+v", result, expected)
+	}
+}
+
+func TestDecodeNode_BillionLaughs(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("a0: &a0 [lol, lol, lol, lol, lol, lol, lol, lol, lol, lol]\n")
+	for i := 1; i <= 9; i++ {
+		fmt.Fprintf(&b, "a%d: &a%d [", i, i)
+		for j := 0; j < 10; j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "*a%d", i-1)
+		}
+		b.WriteString("]\n")
+	}
+
+	node, err := UnmarshalNode([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	var result interface{}
+	err = DecodeNode(node, &result)
+	if err == nil || !strings.Contains(err.Error(), "alias expansion limit") {
+		t.Errorf("DecodeNode() error = %v, want alias expansion limit error", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	input := `db:
+  user: admin
+  password: hunter2 # rotate monthly
+  port: 5432
+hosts:
+  - a.example.com
+cache: {password: s3cret}
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	var paths []string
+	Transform(node, func(path string, s *ast.Scalar) {
+		paths = append(paths, path)
+		if path == "password" || strings.HasSuffix(path, ".password") {
+			s.Value = "REDACTED"
+		} else if s.Tag() == "!!str" {
+			s.Value = strings.ToUpper(s.Value)
+		}
+	})
+
+	expectedPaths := []string{"db.user", "db.password", "db.port", "hosts[0]", "cache.password"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Transform() visited %v, want %v", paths, expectedPaths)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+	expected := `db:
+  user: ADMIN
+  password: REDACTED # rotate monthly
+  port: 5432
+hosts:
+  - A.EXAMPLE.COM
+cache: {password: REDACTED}
+`
+	if string(output) != expected {
+		t.Errorf("MarshalNode() got:\n%s\nwant:\n%s", output, expected)
+	}
+}
+
+func TestFootCommentRoundTrip(t *testing.T) {
+	input := `name: app
+server:
+  host: localhost
+  # end of server
+port: 8080
+# @schema
+# type: object
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("foot comments not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+}
+
+func TestEmptyValueCommentRoundTrip(t *testing.T) {
+	input := `name: null # filled in later
+server: # defaults
+  host: localhost
+port: 8080
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("entry comments not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+
+	var decoded map[string]interface{}
+	if err := Unmarshal([]byte("name: # filled in later\nport: 8080\n"), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	expected := map[string]interface{}{"name": nil, "port": int64(8080)}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Unmarshal() got = %#v, want %#v", decoded, expected)
+	}
+}
+
+func TestDetachedCommentRoundTrip(t *testing.T) {
+	input := `# document comment
+
+# about name
+name: app
+# section break
+
+# about port
+port: 8080
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("comment grouping not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+}
+
+func TestNestedBlockScalarRoundTrip(t *testing.T) {
+	input := `jobs:
+  build:
+    script: |
+      make deps
+        && make build
+      make test
+    name: build
+`
+
+	node, err := UnmarshalNode([]byte(input))
+	if err != nil {
+		t.Fatalf("UnmarshalNode() error = %v", err)
+	}
+
+	output, err := MarshalNode(node)
+	if err != nil {
+		t.Fatalf("MarshalNode() error = %v", err)
+	}
+
+	if string(output) != input {
+		t.Errorf("block scalar not preserved:\nwant:\n%s\ngot:\n%s", input, output)
+	}
+
+	var decoded map[string]map[string]map[string]string
+	if err := Unmarshal(output, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got, want := decoded["jobs"]["build"]["script"], "make deps\n  && make build\nmake test\n"; got != want {
+		t.Errorf("script = %q, want %q", got, want)
+	}
+}